@@ -2,11 +2,15 @@ package main
 
 import (
 	"fmt"
-
 	"slices"
+	"strings"
 
+	"github.com/bayou-brogrammer/mygo/internal/chezmoi"
 	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/system"
+	"github.com/bayou-brogrammer/mygo/internal/ui"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 var cfgCmd = &cobra.Command{
@@ -28,6 +32,48 @@ var cfgRegenerateCmd = &cobra.Command{
 	},
 }
 
+var cfgShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show configuration",
+	Long:  `Show the current configuration, including the resolved chezmoi source directory.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintTitle("Milo Configuration")
+		fmt.Println(ui.FormatKeyValue("config_file", viper.ConfigFileUsed()))
+		fmt.Println(ui.FormatKeyValue("dotfiles_repo", cfg.DotfilesRepo))
+		fmt.Println(ui.FormatKeyValue("dotfiles_dir", cfg.DotfilesDir))
+		fmt.Println(ui.FormatKeyValue("dotfiles_layout", cfg.DotfilesLayout))
+		fmt.Println(ui.FormatKeyValue("dotfiles_link_mode", cfg.DotfilesLinkMode))
+		fmt.Println(ui.FormatKeyValue("tools", fmt.Sprintf("%d configured", len(cfg.Tools))))
+
+		if !chezmoi.Installed() {
+			fmt.Println(ui.FormatKeyValue("chezmoi_dir", cfg.ChezmoiDir))
+			return
+		}
+
+		source, err := chezmoi.Source()
+		if err != nil {
+			fmt.Println(ui.FormatKeyValue("chezmoi_dir", cfg.ChezmoiDir))
+			ui.PrintWarning("%v", err)
+			return
+		}
+
+		dir := source.Dir
+		if source.Custom {
+			dir += " (custom)"
+		}
+		fmt.Println(ui.FormatKeyValue("chezmoi_dir", dir))
+
+		for _, warning := range source.Warnings() {
+			ui.PrintWarning("%s", warning)
+		}
+	},
+}
+
 var cfgToolsCmd = &cobra.Command{
 	Use:   "tools",
 	Short: "Manage preferred tools",
@@ -42,19 +88,42 @@ var cfgToolsCmd = &cobra.Command{
 
 		// Display the list of preferred tools
 		fmt.Println("Tools in your configuration:")
-		for i, tool := range cfg.Tools {
-			fmt.Printf("%d. %s\n", i+1, tool)
+		for i, spec := range cfg.Tools {
+			tool := system.ResolveTool(spec)
+
+			line := fmt.Sprintf("%d. %s", i+1, tool.Name)
+			if tool.Description != "" {
+				line += " - " + tool.Description
+			}
+			if method := tool.InstallMethod(); method != config.MethodPackage {
+				line += fmt.Sprintf(" [%s]", method)
+			}
+			if tool.Optional {
+				line += " (optional)"
+			}
+			fmt.Println(line)
 		}
 	},
 }
 
+// toolSpec holds the flags of cfg tools add
+var toolSpec config.ToolSpec
+
 var cfgToolsAddCmd = &cobra.Command{
 	Use:   "add [tool name]",
 	Short: "Add a tool to preferred tools",
-	Long:  `Add a tool to the list of preferred tools in your configuration.`,
-	Args:  cobra.ExactArgs(1),
+	Long: `Add a tool to the list of preferred tools in your configuration.
+
+Without flags the tool uses milo's built-in spec, or is installed from a
+package of the same name. Flags describe the tool in full and replace the
+spec of a tool already in the list.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		toolName := args[0]
+		spec := toolSpec
+		spec.Name = args[0]
+		if err := spec.Validate(); err != nil {
+			exitWithError(err)
+		}
 
 		// Get the configuration
 		cfg, err := config.GetConfig()
@@ -64,13 +133,20 @@ var cfgToolsAddCmd = &cobra.Command{
 		}
 
 		// Check if the tool is already in the list
-		if slices.Contains(cfg.Tools, toolName) {
-			fmt.Printf("%s is already in your tools list\n", toolName)
+		index := slices.IndexFunc(cfg.Tools, func(tool config.ToolSpec) bool {
+			return tool.Name == spec.Name
+		})
+		if index >= 0 && cmd.Flags().NFlag() == 0 {
+			fmt.Printf("%s is already in your tools list\n", spec.Name)
 			return
 		}
 
-		// Add the tool to the list
-		cfg.Tools = append(cfg.Tools, toolName)
+		// Add the tool to the list, or replace its spec
+		if index >= 0 {
+			cfg.Tools[index] = spec
+		} else {
+			cfg.Tools = append(cfg.Tools, spec)
+		}
 
 		// Save the configuration
 		if err := cfg.Save(); err != nil {
@@ -78,7 +154,11 @@ var cfgToolsAddCmd = &cobra.Command{
 			return
 		}
 
-		fmt.Printf("%s added to your preferred tools list\n", toolName)
+		if index >= 0 {
+			fmt.Printf("%s updated in your preferred tools list\n", spec.Name)
+		} else {
+			fmt.Printf("%s added to your preferred tools list\n", spec.Name)
+		}
 	},
 }
 
@@ -99,9 +179,9 @@ var cfgToolsRemoveCmd = &cobra.Command{
 
 		// Check if the tool is in the list
 		found := false
-		newTools := []string{}
+		newTools := []config.ToolSpec{}
 		for _, tool := range cfg.Tools {
-			if tool == toolName {
+			if tool.Name == toolName {
 				found = true
 			} else {
 				newTools = append(newTools, tool)
@@ -127,12 +207,29 @@ var cfgToolsRemoveCmd = &cobra.Command{
 }
 
 func init() {
+	// Add tools add flags
+	cfgToolsAddCmd.Flags().StringVarP(&toolSpec.Description, "description", "d", "", "Description of the tool")
+	cfgToolsAddCmd.Flags().StringToStringVarP(&toolSpec.Packages, "package", "p", nil, "Package for a package manager, as manager=package")
+	cfgToolsAddCmd.Flags().StringSliceVarP(&toolSpec.Binaries, "binary", "b", nil, "Binary that shows the tool is installed")
+	cfgToolsAddCmd.Flags().StringVar(&toolSpec.Version, "pin", "", "Version the tool is pinned to")
+	cfgToolsAddCmd.Flags().StringVar(&toolSpec.MinVersion, "min-version", "", "Lowest acceptable version")
+	cfgToolsAddCmd.Flags().StringVar(&toolSpec.VersionCommand, "version-command", "", "Command that prints the version")
+	cfgToolsAddCmd.Flags().StringVar(&toolSpec.VersionRegex, "version-regex", "", "Regular expression that extracts the version")
+	cfgToolsAddCmd.Flags().StringSliceVarP(&toolSpec.Tags, "tag", "t", nil, "Tag for selecting the tool")
+	cfgToolsAddCmd.Flags().StringSliceVar(&toolSpec.Platforms, "platform", nil, "Platform to install on, as GOOS or GOOS/GOARCH")
+	cfgToolsAddCmd.Flags().BoolVar(&toolSpec.Optional, "optional", false, "Only warn when the tool fails to install")
+	cfgToolsAddCmd.Flags().StringVarP(&toolSpec.Method, "method", "m", "", fmt.Sprintf("Install method: %s", strings.Join(config.Methods, ", ")))
+	cfgToolsAddCmd.Flags().StringVarP(&toolSpec.Source, "source", "s", "", "Module, crate, package, archive URL or script for the install method")
+	cfgToolsAddCmd.Flags().StringToStringVar(&toolSpec.Checksums, "sha256", nil, "SHA-256 of the archive for a platform, as GOOS/GOARCH=sum")
+	cfgToolsAddCmd.Flags().BoolVar(&toolSpec.SkipChecksum, "skip-checksum", false, "Install the archive without a pinned SHA-256")
+
 	// Add tools subcommands
 	cfgToolsCmd.AddCommand(cfgToolsAddCmd)
 	cfgToolsCmd.AddCommand(cfgToolsRemoveCmd)
 
 	// Add all subcommands to cfg command
 	cfgCmd.AddCommand(cfgRegenerateCmd)
+	cfgCmd.AddCommand(cfgShowCmd)
 	cfgCmd.AddCommand(cfgToolsCmd)
 
 	// Add cfg command to root
@@ -2,7 +2,11 @@ package main
 
 import (
 	"fmt"
+	"sort"
 
+	"github.com/bayou-brogrammer/mygo/internal/chezmoi"
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/ui"
 	"github.com/spf13/cobra"
 )
 
@@ -19,24 +23,46 @@ var chezmoiInitCmd = &cobra.Command{
 	Use:   "init [repository URL]",
 	Short: "Initialize chezmoi",
 	Long:  `Initialize chezmoi with an optional dotfiles repository.`,
+	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		var repoURL string
 		if len(args) > 0 {
-			fmt.Printf("Initializing chezmoi with repository: %s\n", args[0])
-			// TODO: Implement chezmoi initialization with repository
+			repoURL = args[0]
+			ui.PrintInfo("Initializing chezmoi with repository: %s", repoURL)
 		} else {
-			fmt.Println("Initializing chezmoi")
-			// TODO: Implement basic chezmoi initialization
+			ui.PrintInfo("Initializing chezmoi")
 		}
+
+		err := chezmoi.InitWithOptions(repoURL, chezmoi.InitOptions{
+			NonInteractive: nonInteractive,
+			Verbose:        verbose,
+		})
+		if err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintSuccess("Chezmoi initialized")
+		printSourceWarnings()
 	},
 }
 
+var chezmoiApplyInteractive bool
+
 var chezmoiApplyCmd = &cobra.Command{
 	Use:   "apply",
 	Short: "Apply chezmoi configuration",
-	Long:  `Apply chezmoi configuration to the system.`,
+	Long: `Apply chezmoi configuration to the system.
+With --interactive the diff of each target is shown and you are asked before it is applied.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Applying chezmoi configuration")
-		// TODO: Implement chezmoi apply logic
+		err := chezmoi.ApplyWithOptions(chezmoi.ApplyOptions{
+			Interactive: chezmoiApplyInteractive,
+			Verbose:     verbose,
+		})
+		if err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintSuccess("Chezmoi configuration applied")
 	},
 }
 
@@ -45,27 +71,296 @@ var chezmoiUpdateCmd = &cobra.Command{
 	Short: "Update chezmoi",
 	Long:  `Update chezmoi-managed files from the source repository.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Updating chezmoi configuration")
-		// TODO: Implement chezmoi update logic
+		if err := chezmoi.UpdateWithOptions(chezmoi.UpdateOptions{Verbose: verbose}); err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintSuccess("Chezmoi updated")
+		printSourceWarnings()
 	},
 }
 
 var chezmoiAddCmd = &cobra.Command{
-	Use:   "add [file path]",
-	Short: "Add a file to chezmoi",
-	Long:  `Add a new file to be managed by chezmoi.`,
+	Use:   "add [file path]...",
+	Short: "Add files to chezmoi",
+	Long:  `Add one or more files to be managed by chezmoi.`,
 	Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		filePath := args[0]
-		fmt.Printf("Adding file to chezmoi: %s\n", filePath)
-		// TODO: Implement logic to add file to chezmoi
+		failed := 0
+		for _, filePath := range args {
+			if err := chezmoi.AddWithOptions(filePath, chezmoi.AddOptions{Verbose: verbose}); err != nil {
+				ui.PrintError("%v", err)
+				failed++
+				continue
+			}
+			ui.PrintSuccess("Added %s to chezmoi", filePath)
+		}
+
+		if failed > 0 {
+			exitWithError(fmt.Errorf("failed to add %d of %d files", failed, len(args)))
+		}
+		printSourceWarnings()
+	},
+}
+
+var chezmoiStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show chezmoi status",
+	Long:  `Show every target chezmoi manages and what chezmoi apply would change.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		entries, err := chezmoi.Status()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintTitle("Chezmoi Status")
+		for _, entry := range entries {
+			name := entry.RelPath
+			if entry.Local != chezmoi.ChangeNone {
+				name = fmt.Sprintf("%s {%s since last apply}", name, entry.Local)
+			}
+
+			switch {
+			case entry.Clean():
+				ui.PrintSuccess("%-9s %s", "clean", name)
+			case entry.Local != chezmoi.ChangeNone:
+				// Applying would overwrite changes made outside chezmoi
+				ui.PrintError("%-9s %s", entry.Pending, name)
+			default:
+				ui.PrintWarning("%-9s %s", entry.Pending, name)
+			}
+		}
+	},
+}
+
+var chezmoiDiffCmd = &cobra.Command{
+	Use:   "diff [target]...",
+	Short: "Show chezmoi changes",
+	Long:  `Show the changes chezmoi apply would make, optionally limited to the given targets.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		diffs, err := chezmoi.Diff(args...)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if len(diffs) == 0 {
+			ui.PrintSuccess("No changes to apply")
+			return
+		}
+
+		for _, diff := range diffs {
+			ui.PrintSubtitle(diff.RelPath)
+			ui.PrintDiff(diff.Patch)
+		}
+	},
+}
+
+var chezmoiDataCmd = &cobra.Command{
+	Use:   "data",
+	Short: "Show chezmoi template data",
+	Long: `Show the template data milo keeps for chezmoi and report variables the
+source templates use that aren't defined anywhere.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.GetConfig()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintTitle("Chezmoi Template Data")
+		keys := make([]string, 0, len(cfg.ChezmoiData))
+		for key := range cfg.ChezmoiData {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Println(ui.FormatKeyValue(key, cfg.ChezmoiData[key]))
+		}
+
+		undefined, err := chezmoi.UndefinedVars()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if len(undefined) > 0 {
+			for _, key := range undefined {
+				ui.PrintWarning("undefined .%s", key)
+			}
+			exitWithError(fmt.Errorf("%d template variables are undefined, set them with 'milo chezmoi data set' or run 'milo chezmoi init'", len(undefined)))
+		}
+	},
+}
+
+var chezmoiDataSetCmd = &cobra.Command{
+	Use:   "set [key] [value]",
+	Short: "Set chezmoi template data",
+	Long:  `Set a template variable in the milo config and merge it into chezmoi's config file.`,
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := chezmoi.SetData(args[0], args[1]); err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintSuccess("Set .%s", args[0])
+	},
+}
+
+var chezmoiBootstrapCmd = &cobra.Command{
+	Use:   "bootstrap",
+	Short: "Install chezmoi",
+	Long: `Install chezmoi with the system package manager, or from the binary or tarball
+configured as chezmoi_binary when no package manager can install it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := chezmoi.BootstrapWithOptions(chezmoi.BootstrapOptions{Verbose: verbose}); err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintSuccess("Chezmoi is installed")
+	},
+}
+
+var chezmoiExternalCmd = &cobra.Command{
+	Use:   "external",
+	Short: "Manage chezmoi externals",
+	Long:  `List the archives and git repositories chezmoi downloads into your home directory.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		externals, err := chezmoi.Externals()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintTitle("Chezmoi Externals")
+		if len(externals) == 0 {
+			ui.PrintInfo("No externals, add one with 'milo chezmoi external add'")
+			return
+		}
+
+		for _, external := range externals {
+			ui.PrintInfo("%-9s %s", external.Type, external.Path)
+			fmt.Println(ui.FormatKeyValue("  url", external.URL))
+			if external.RefreshPeriod != "" {
+				fmt.Println(ui.FormatKeyValue("  refresh", external.RefreshPeriod))
+			}
+		}
+	},
+}
+
+var externalOptions chezmoi.External
+
+var chezmoiExternalAddCmd = &cobra.Command{
+	Use:   "add [target] [url]",
+	Short: "Add a chezmoi external",
+	Long: `Add an archive or git repository that chezmoi downloads into target, a path in
+your home directory. An existing external for the same target is replaced.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		external := externalOptions
+		external.Path = args[0]
+		external.URL = args[1]
+
+		if err := chezmoi.AddExternal(external); err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintSuccess("Added %s external %s", external.Type, args[0])
+	},
+}
+
+var chezmoiExternalRemoveCmd = &cobra.Command{
+	Use:   "remove [target]",
+	Short: "Remove a chezmoi external",
+	Long:  `Remove the external for a target from the chezmoi source directory.`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := chezmoi.RemoveExternal(args[0]); err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintSuccess("Removed external %s", args[0])
 	},
 }
 
+var chezmoiImportDotsCmd = &cobra.Command{
+	Use:   "import-dots",
+	Short: "Move your dotfiles repository into chezmoi",
+	Long: `Add every file managed by 'milo dots' to chezmoi, replace the dotfiles links
+with plain files and check the result with 'chezmoi verify'. Files chezmoi
+already manages are skipped, so the import can be run again. Use --dry-run to
+preview the chezmoi source names without changing anything.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		entries, err := chezmoi.ImportDotsWithOptions(chezmoi.ImportOptions{DryRun: dryRun})
+
+		ui.PrintTitle("Import Dotfiles")
+		added := 0
+		for _, entry := range entries {
+			line := fmt.Sprintf("%s -> %s", entry.Target, entry.SourceName)
+			if entry.Note != "" {
+				line = fmt.Sprintf("%s (%s)", line, entry.Note)
+			}
+
+			switch entry.Action {
+			case chezmoi.ImportAdd:
+				added++
+				if dryRun {
+					ui.PrintInfo("would add %s", line)
+				} else {
+					ui.PrintSuccess("added     %s", line)
+				}
+			case chezmoi.ImportManaged:
+				ui.PrintInfo("managed   %s", entry.Target)
+			default:
+				ui.PrintWarning("skipped   %s", line)
+			}
+		}
+
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if dryRun {
+			ui.PrintInfo("%d files would be imported", added)
+			return
+		}
+
+		ui.PrintSuccess("Imported %d files into chezmoi", added)
+		printSourceWarnings()
+	},
+}
+
+// printSourceWarnings warns about a chezmoi source directory that isn't
+// backed up by a pushed git repository
+func printSourceWarnings() {
+	source, err := chezmoi.Source()
+	if err != nil {
+		ui.PrintWarning("%v", err)
+		return
+	}
+
+	for _, warning := range source.Warnings() {
+		ui.PrintWarning("%s", warning)
+	}
+}
+
 func init() {
+	chezmoiInitCmd.Flags().BoolVarP(&nonInteractive, "non-interactive", "n", false, "Read template data from MILO_CHEZMOI_* environment variables instead of prompting")
+	chezmoiApplyCmd.Flags().BoolVarP(&chezmoiApplyInteractive, "interactive", "i", false, "Show the diff of each target and ask before applying it")
+
 	chezmoiCmd.AddCommand(chezmoiInitCmd)
 	chezmoiCmd.AddCommand(chezmoiApplyCmd)
 	chezmoiCmd.AddCommand(chezmoiUpdateCmd)
 	chezmoiCmd.AddCommand(chezmoiAddCmd)
+	chezmoiCmd.AddCommand(chezmoiStatusCmd)
+	chezmoiCmd.AddCommand(chezmoiDiffCmd)
+	chezmoiExternalAddCmd.Flags().StringVarP(&externalOptions.Type, "type", "t", chezmoi.ExternalArchive, "External type: archive or git-repo")
+	chezmoiExternalAddCmd.Flags().BoolVar(&externalOptions.Exact, "exact", false, "Remove files in the target that aren't in the archive")
+	chezmoiExternalAddCmd.Flags().IntVar(&externalOptions.StripComponents, "strip-components", 0, "Leading path components to strip from archive entries")
+	chezmoiExternalAddCmd.Flags().StringVar(&externalOptions.RefreshPeriod, "refresh", "", "How often to download or pull again, such as 168h")
+
+	chezmoiDataCmd.AddCommand(chezmoiDataSetCmd)
+	chezmoiCmd.AddCommand(chezmoiDataCmd)
+	chezmoiExternalCmd.AddCommand(chezmoiExternalAddCmd)
+	chezmoiExternalCmd.AddCommand(chezmoiExternalRemoveCmd)
+	chezmoiCmd.AddCommand(chezmoiExternalCmd)
+	chezmoiCmd.AddCommand(chezmoiBootstrapCmd)
+	chezmoiCmd.AddCommand(chezmoiImportDotsCmd)
 	rootCmd.AddCommand(chezmoiCmd)
 }
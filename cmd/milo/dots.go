@@ -1,8 +1,13 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 
+	"github.com/bayou-brogrammer/mygo/internal/dots"
+	"github.com/bayou-brogrammer/mygo/internal/ui"
 	"github.com/spf13/cobra"
 )
 
@@ -19,24 +24,45 @@ var dotsInitCmd = &cobra.Command{
 	Use:   "init [repository URL]",
 	Short: "Initialize dotfiles",
 	Long:  `Initialize dotfiles from a repository or create a new dotfiles repository.`,
+	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
+		var repoURL string
 		if len(args) > 0 {
-			fmt.Printf("Initializing dotfiles from repository: %s\n", args[0])
-			// TODO: Implement dotfiles initialization from repository
+			repoURL = args[0]
+			ui.PrintInfo("Initializing dotfiles from repository: %s", repoURL)
 		} else {
-			fmt.Println("Creating new dotfiles repository")
-			// TODO: Implement new dotfiles repository creation
+			ui.PrintInfo("Creating new dotfiles repository")
 		}
+
+		if err := dots.InitWithOptions(repoURL, dots.InitOptions{Verbose: verbose}); err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintSuccess("Dotfiles initialized")
 	},
 }
 
+var applyForce bool
+
 var dotsApplyCmd = &cobra.Command{
 	Use:   "apply",
 	Short: "Apply dotfiles configuration",
-	Long:  `Apply dotfiles configuration to the system.`,
+	Long: `Apply dotfiles configuration to the system.
+Scripts in .milo/hooks/before and .milo/hooks/after of the dotfiles repository
+run before and after the dotfiles are deployed.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Applying dotfiles configuration")
-		// TODO: Implement dotfiles application logic
+		err := dots.ApplyWithOptions(dots.ApplyOptions{
+			Force:   applyForce,
+			DryRun:  dryRun,
+			Verbose: verbose,
+		})
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if !dryRun {
+			ui.PrintSuccess("Dotfiles applied")
+		}
 	},
 }
 
@@ -45,27 +71,292 @@ var dotsUpdateCmd = &cobra.Command{
 	Short: "Update dotfiles",
 	Long:  `Update dotfiles from the repository.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("Updating dotfiles")
-		// TODO: Implement dotfiles update logic
+		if err := dots.UpdateWithOptions(dots.UpdateOptions{Verbose: verbose}); err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintSuccess("Dotfiles updated")
 	},
 }
 
+var addOptions = dots.AddOptions{Symlinks: dots.SymlinkSkip}
+
 var dotsAddCmd = &cobra.Command{
-	Use:   "add [file path]",
-	Short: "Add a file to dotfiles",
-	Long:  `Add a new file to the dotfiles repository.`,
+	Use:   "add [path]...",
+	Short: "Add files to dotfiles",
+	Long: `Add one or more files or directories to the dotfiles repository and replace
+them with links. Each path is added and committed on its own, so a failure
+leaves the paths added before it in place.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		addOptions.Verbose = verbose
+
+		failed := 0
+		for _, filePath := range args {
+			if err := dots.AddWithOptions(filePath, addOptions); err != nil {
+				ui.PrintError("%v", err)
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			exitWithError(fmt.Errorf("failed to add %d of %d paths", failed, len(args)))
+		}
+	},
+}
+
+var dotsStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show dotfiles status",
+	Long:  `Show whether each dotfile is linked, missing, or conflicts with an existing file.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		entries, err := dots.Status()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintTitle("Dotfiles Status")
+		for _, entry := range entries {
+			name := entry.RelPath
+			if entry.Package != "" {
+				name = fmt.Sprintf("%s (%s)", entry.RelPath, entry.Package)
+			}
+
+			if entry.Mode != dots.ModeSymlink {
+				name = fmt.Sprintf("%s [%s]", name, entry.Mode)
+			}
+
+			if entry.Reason != "" {
+				variant := entry.Variant
+				if variant == "" {
+					variant = "default"
+				}
+				name = fmt.Sprintf("%s {%s: %s}", name, variant, entry.Reason)
+			}
+
+			switch entry.State {
+			case dots.StateLinked:
+				ui.PrintSuccess("%-9s %s", entry.State, name)
+			case dots.StateMissing, dots.StateOutdated, dots.StateOrphaned:
+				ui.PrintWarning("%-9s %s", entry.State, name)
+			default:
+				ui.PrintError("%-9s %s", entry.State, name)
+			}
+		}
+	},
+}
+
+var syncOptions dots.SyncOptions
+
+var dotsSyncCmd = &cobra.Command{
+	Use:   "sync",
+	Short: "Commit, pull and push dotfiles",
+	Long: `Commit changes to managed dotfiles, pull remote changes with rebase, push,
+and link any files that were added on other machines.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := dots.SyncWithOptions(syncOptions)
+
+		var conflict *dots.ConflictError
+		if errors.As(err, &conflict) {
+			ui.PrintError("Pulling stopped on conflicting changes:")
+			for _, path := range conflict.Paths {
+				ui.PrintWarning("  %s", path)
+			}
+			ui.PrintInfo("Resolve them in %s and run 'git rebase --continue', or 'git rebase --abort' to undo the pull", conflict.Dir)
+			os.Exit(1)
+		}
+
+		if err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintSuccess("Dotfiles synced")
+	},
+}
+
+var unlinkForce bool
+
+var dotsUnlinkCmd = &cobra.Command{
+	Use:   "unlink [target]...",
+	Short: "Remove managed dotfiles from your home directory",
+	Long: `Remove the given dotfile targets from your home directory and stop managing them.
+Without arguments every managed target is removed. Copies edited since they were
+deployed are kept unless --force is given.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := dots.UnlinkWithOptions(dots.UnlinkOptions{Force: unlinkForce}, args...); err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintSuccess("Unlinked dotfiles")
+	},
+}
+
+var pruneOptions dots.PruneOptions
+
+var dotsPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove dotfiles whose source is gone",
+	Long: `Remove managed targets whose source was deleted from the dotfiles repository
+or is no longer deployed to this machine.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		pruneOptions.DryRun = dryRun
+		orphans, err := dots.PruneWithOptions(pruneOptions)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		if len(orphans) == 0 {
+			ui.PrintSuccess("Nothing to prune")
+			return
+		}
+
+		if pruneOptions.DryRun {
+			for _, orphan := range orphans {
+				ui.PrintInfo("Would prune %s", orphan.Target)
+			}
+			return
+		}
+
+		ui.PrintSuccess("Pruned %d targets", len(orphans))
+	},
+}
+
+var packagesHost string
+
+var dotsPackagesCmd = &cobra.Command{
+	Use:   "packages",
+	Short: "List dotfiles packages",
+	Long:  `List the packages in your dotfiles repository and whether they are enabled on this machine.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		packages, err := dots.ListPackages()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintTitle("Dotfiles Packages")
+		for _, pkg := range packages {
+			if pkg.Enabled {
+				ui.PrintSuccess("enabled   %s", pkg.Name)
+			} else {
+				ui.PrintInfo("disabled  %s", pkg.Name)
+			}
+		}
+	},
+}
+
+var dotsEnableCmd = &cobra.Command{
+	Use:   "enable [package]...",
+	Short: "Enable dotfiles packages",
+	Long:  `Enable one or more dotfiles packages for this machine or the host given with --host.`,
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := dots.Enable(packagesHost, args...); err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintSuccess("Enabled %s", strings.Join(args, ", "))
+	},
+}
+
+var dotsDisableCmd = &cobra.Command{
+	Use:   "disable [package]...",
+	Short: "Disable dotfiles packages",
+	Long:  `Disable one or more dotfiles packages and remove their links from your home directory.`,
 	Args:  cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		filePath := args[0]
-		fmt.Printf("Adding file to dotfiles: %s\n", filePath)
-		// TODO: Implement logic to add file to dotfiles
+		if err := dots.Disable(packagesHost, args...); err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintSuccess("Disabled %s", strings.Join(args, ", "))
+	},
+}
+
+var dotsKeyCmd = &cobra.Command{
+	Use:   "key",
+	Short: "Manage the dotfiles encryption key",
+	Long:  `Commands for generating and rotating the key used to encrypt secrets in your dotfiles repository.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+var dotsKeyGenerateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate an encryption key",
+	Long:  `Generate this machine's encryption key and add its public key to the recipients.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		publicKey, err := dots.GenerateKey()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintSuccess("Generated encryption key")
+		ui.PrintInfo("Public key: %s", publicKey)
+	},
+}
+
+var dotsKeyRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Rotate the encryption key",
+	Long:  `Replace this machine's encryption key and re-encrypt every encrypted dotfile with the new key.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		publicKey, err := dots.RotateKey()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		ui.PrintSuccess("Rotated encryption key")
+		ui.PrintInfo("New public key: %s", publicKey)
+		ui.PrintWarning("Commit the re-encrypted files and share the new public key with your other machines")
+	},
+}
+
+var dotsReencryptCmd = &cobra.Command{
+	Use:   "reencrypt",
+	Short: "Re-encrypt encrypted dotfiles",
+	Long:  `Re-encrypt every encrypted dotfile to the current list of recipients.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		paths, err := dots.Reencrypt()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		for _, path := range paths {
+			ui.PrintInfo("Re-encrypted %s", path)
+		}
+		ui.PrintSuccess("Re-encrypted %d files", len(paths))
 	},
 }
 
 func init() {
+	dotsAddCmd.Flags().StringVarP(&addOptions.Package, "package", "p", "", "Package to add the files to")
+	dotsAddCmd.Flags().BoolVar(&addOptions.Encrypt, "encrypt", false, "Store the files encrypted")
+	dotsAddCmd.Flags().StringVar(&addOptions.Symlinks, "symlinks", dots.SymlinkSkip, "How to handle symlinks in directories: skip, follow or preserve")
+	dotsApplyCmd.Flags().BoolVar(&applyForce, "force", false, "Overwrite copied files that were edited since they were deployed")
+	dotsSyncCmd.Flags().StringVarP(&syncOptions.Message, "message", "m", "", "Commit message (default lists the changed files)")
+	dotsSyncCmd.Flags().BoolVar(&syncOptions.NoPush, "no-push", false, "Commit and pull without pushing")
+	dotsUnlinkCmd.Flags().BoolVar(&unlinkForce, "force", false, "Also remove copies edited since they were deployed")
+	dotsPruneCmd.Flags().BoolVar(&pruneOptions.Force, "force", false, "Also remove copies edited since they were deployed")
+
+	dotsEnableCmd.Flags().StringVar(&packagesHost, "host", "", "Host to change packages for (default is this machine, use \"default\" for all hosts)")
+	dotsDisableCmd.Flags().StringVar(&packagesHost, "host", "", "Host to change packages for (default is this machine, use \"default\" for all hosts)")
+
 	dotsCmd.AddCommand(dotsInitCmd)
 	dotsCmd.AddCommand(dotsApplyCmd)
 	dotsCmd.AddCommand(dotsUpdateCmd)
 	dotsCmd.AddCommand(dotsAddCmd)
+	dotsCmd.AddCommand(dotsStatusCmd)
+	dotsCmd.AddCommand(dotsSyncCmd)
+	dotsCmd.AddCommand(dotsUnlinkCmd)
+	dotsCmd.AddCommand(dotsPruneCmd)
+	dotsCmd.AddCommand(dotsPackagesCmd)
+	dotsCmd.AddCommand(dotsEnableCmd)
+	dotsCmd.AddCommand(dotsDisableCmd)
+
+	dotsKeyCmd.AddCommand(dotsKeyGenerateCmd)
+	dotsKeyCmd.AddCommand(dotsKeyRotateCmd)
+	dotsCmd.AddCommand(dotsKeyCmd)
+	dotsCmd.AddCommand(dotsReencryptCmd)
 	rootCmd.AddCommand(dotsCmd)
 }
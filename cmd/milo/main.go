@@ -7,6 +7,7 @@ import (
 	"github.com/bayou-brogrammer/mygo/internal/config"
 	"github.com/bayou-brogrammer/mygo/internal/logger"
 	"github.com/bayou-brogrammer/mygo/internal/ui"
+	"github.com/bayou-brogrammer/mygo/internal/version"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -14,6 +15,7 @@ import (
 var (
 	cfgFile  string
 	verbose  bool
+	dryRun   bool
 	logLevel string
 )
 
@@ -51,6 +53,7 @@ func init() {
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.config/milo/config.yaml)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "enable verbose output")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "show what would change without changing anything")
 	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "set log level (debug, info, warn, error, fatal)")
 
 	// Register commands - these are defined in their respective files
@@ -61,7 +64,7 @@ func init() {
 		Use:   "version",
 		Short: "Print the version number",
 		Run: func(cmd *cobra.Command, args []string) {
-			ui.PrintInfo("Milo CLI v0.1.0")
+			ui.PrintInfo("Milo CLI v%s", version.Version)
 		},
 	})
 }
@@ -93,6 +96,12 @@ func initConfig() {
 	}
 }
 
+// exitWithError prints err and exits with a non-zero status
+func exitWithError(err error) {
+	ui.PrintError("%v", err)
+	os.Exit(1)
+}
+
 func main() {
 	// Ensure logger is closed when program exits
 	defer logger.Close()
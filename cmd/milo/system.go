@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"github.com/bayou-brogrammer/mygo/internal/system"
-	"github.com/bayou-brogrammer/mygo/internal/ui"
 	"github.com/spf13/cobra"
 )
 
@@ -20,6 +19,7 @@ var systemCmd = &cobra.Command{
 var (
 	forceInstall   bool
 	skipExisting   bool
+	installTags    []string
 	nonInteractive bool
 )
 
@@ -38,11 +38,11 @@ var systemInstallCmd = &cobra.Command{
 			Force:        forceInstall,
 			SkipExisting: skipExisting,
 			Verbose:      verbose,
+			Tags:         installTags,
 		}
 
-		err := system.InstallWithOptions(toolName, options)
-		if err != nil {
-			ui.PrintError("%v", err)
+		if err := system.InstallWithOptions(toolName, options); err != nil {
+			exitWithError(err)
 		}
 	},
 }
@@ -87,16 +87,130 @@ var systemUpdateCmd = &cobra.Command{
 	},
 }
 
+var systemCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "Check installed tools",
+	Long: `Check that the tools from your configuration are installed and meet their
+minimum and pinned versions. Exits non-zero when any required tool doesn't.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		// Set options based on flags
+		options := system.CheckOptions{
+			Tags:    installTags,
+			Verbose: verbose,
+		}
+
+		if err := system.CheckWithOptions(options); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+var systemUninstallCmd = &cobra.Command{
+	Use:   "uninstall [tool name]",
+	Short: "Uninstall a tool",
+	Long: `Uninstall a tool milo installed. Only what milo installed is removed:
+the package, or the files an archive, go install or script wrote.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Set options based on flags
+		options := system.UninstallOptions{
+			DryRun:  dryRun,
+			Verbose: verbose,
+		}
+
+		if err := system.UninstallWithOptions(args[0], options); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+var systemListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List tools and where they came from",
+	Long:  `List the configured tools and the tools milo installed, with their version and install source.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := system.ListWithOptions(system.ListOptions{Verbose: verbose}); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+var systemSnapshotCmd = &cobra.Command{
+	Use:   "snapshot [lockfile]",
+	Short: "Save the state of this machine to a lockfile",
+	Long: `Save the installed tools and their versions, the package manager, OS and
+distribution, and the tracked repositories at their commits to a lockfile,
+milo.lock by default.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := system.DefaultLockfile
+		if len(args) > 0 {
+			path = args[0]
+		}
+
+		if err := system.SnapshotWithOptions(path, system.SnapshotOptions{Verbose: verbose}); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+var systemRestoreCmd = &cobra.Command{
+	Use:   "restore [lockfile]",
+	Short: "Bring this machine close to a lockfile",
+	Long: `Install the tools from a lockfile that are missing, upgrade archives to their
+locked versions and clone missing repositories at their locked commits, then
+report what still differs. Repositories that already exist are left as they are.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		// Set options based on flags
+		options := system.RestoreOptions{
+			DryRun:  dryRun,
+			Verbose: verbose,
+		}
+
+		if err := system.RestoreWithOptions(args[0], options); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+var systemDiffCmd = &cobra.Command{
+	Use:   "diff [a.lock] [b.lock]",
+	Short: "Explain how two lockfiles differ",
+	Long:  `Explain how two lockfiles differ, or how a lockfile differs from this machine when given one.`,
+	Args:  cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		var pathB string
+		if len(args) > 1 {
+			pathB = args[1]
+		}
+
+		if err := system.Diff(args[0], pathB); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
 func init() {
 	// Add flags to install command
 	systemInstallCmd.Flags().BoolVarP(&forceInstall, "force", "f", false, "Force installation even if the tool is already installed")
+	systemInstallCmd.Flags().StringSliceVarP(&installTags, "tag", "t", nil, "Only install configured tools with this tag")
 	systemInstallCmd.Flags().BoolVarP(&skipExisting, "skip-existing", "s", true, "Skip installation if the tool is already installed")
 
+	// Add flags to check command
+	systemCheckCmd.Flags().StringSliceVarP(&installTags, "tag", "t", nil, "Only check configured tools with this tag")
+
 	// Add flags to configure command
 	systemConfigureCmd.Flags().BoolVarP(&nonInteractive, "non-interactive", "n", false, "Run in non-interactive mode (requires environment variables for input)")
 
 	systemCmd.AddCommand(systemInstallCmd)
 	systemCmd.AddCommand(systemConfigureCmd)
 	systemCmd.AddCommand(systemUpdateCmd)
+	systemCmd.AddCommand(systemCheckCmd)
+	systemCmd.AddCommand(systemUninstallCmd)
+	systemCmd.AddCommand(systemListCmd)
+	systemCmd.AddCommand(systemSnapshotCmd)
+	systemCmd.AddCommand(systemRestoreCmd)
+	systemCmd.AddCommand(systemDiffCmd)
 	rootCmd.AddCommand(systemCmd)
 }
@@ -0,0 +1,126 @@
+package chezmoi
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/system"
+)
+
+// BootstrapOptions defines options for installing chezmoi
+type BootstrapOptions struct {
+	// Show commands and their error output
+	Verbose bool
+}
+
+// Bootstrap makes sure chezmoi is installed
+func Bootstrap() error {
+	return BootstrapWithOptions(BootstrapOptions{})
+}
+
+// BootstrapWithOptions installs chezmoi with the system package manager when
+// it isn't installed yet. If that fails, chezmoi is installed into
+// ~/.local/bin from the binary or tarball configured as chezmoi_binary,
+// checked against chezmoi_sha256.
+func BootstrapWithOptions(options BootstrapOptions) error {
+	if Installed() {
+		return nil
+	}
+
+	fmt.Println("chezmoi is not installed, installing it")
+
+	installErr := system.InstallWithOptions("chezmoi", system.InstallOptions{
+		SkipExisting: true,
+		Verbose:      options.Verbose,
+	})
+	if installErr == nil && Installed() {
+		return nil
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+
+	if cfg.ChezmoiBinary == "" {
+		if installErr == nil {
+			installErr = fmt.Errorf("chezmoi is not on PATH after installing it")
+		}
+		return fmt.Errorf("%w, set chezmoi_binary to a local binary or tarball to install chezmoi from", installErr)
+	}
+
+	target, err := localBinary()
+	if err != nil {
+		return err
+	}
+
+	if err := installBinary(cfg.ChezmoiBinary, cfg.ChezmoiSHA256, target); err != nil {
+		return fmt.Errorf("failed to install chezmoi from %s: %w", cfg.ChezmoiBinary, err)
+	}
+
+	fmt.Printf("Installed chezmoi to %s\n", target)
+	return nil
+}
+
+// Installed reports whether chezmoi is on PATH or was bootstrapped into
+// ~/.local/bin
+func Installed() bool {
+	_, err := binary()
+	return err == nil
+}
+
+// binary returns the chezmoi executable to run
+func binary() (string, error) {
+	if path, err := exec.LookPath("chezmoi"); err == nil {
+		return path, nil
+	}
+
+	path, err := localBinary()
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(path); err != nil || info.IsDir() {
+		return "", fmt.Errorf("chezmoi is not installed, please install it first")
+	}
+
+	return path, nil
+}
+
+// localBinary returns where bootstrapped chezmoi binaries are installed
+func localBinary() (string, error) {
+	dir, err := system.UserBinDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "chezmoi"), nil
+}
+
+// installBinary installs chezmoi to target from source, which is a binary or
+// a .tar.gz or .zip archive given as a local path or an http(s) URL. The
+// download must match checksum, which only a local path may leave empty.
+func installBinary(source, checksum, target string) error {
+	archive, sum, err := system.Download(source)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive)
+
+	if checksum == "" {
+		if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+			return fmt.Errorf("no sha256 pinned for %s, set chezmoi_sha256 to its sha256 %s", source, sum)
+		}
+	} else if !strings.EqualFold(checksum, sum) {
+		return fmt.Errorf("checksum mismatch for %s: expected sha256 %s, got %s", source, checksum, sum)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	_, err = system.ExtractBinaries(archive, source, []string{filepath.Base(target)}, filepath.Dir(target))
+	return err
+}
@@ -0,0 +1,68 @@
+package chezmoi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestInstallBinaryChecksum(t *testing.T) {
+	body := []byte("chezmoi binary")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	sum := sha256.Sum256(body)
+	checksum := hex.EncodeToString(sum[:])
+
+	local := filepath.Join(t.TempDir(), "chezmoi")
+	if err := os.WriteFile(local, body, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		source   string
+		checksum string
+		wantErr  string
+	}{
+		{"pinned url", server.URL + "/chezmoi", checksum, ""},
+		{"upper case checksum", server.URL + "/chezmoi", strings.ToUpper(checksum), ""},
+		{"url without checksum", server.URL + "/chezmoi", "", "set chezmoi_sha256"},
+		{"checksum mismatch", server.URL + "/chezmoi", strings.Repeat("0", 64), "checksum mismatch"},
+		{"local path without checksum", local, "", ""},
+		{"local path mismatch", local, strings.Repeat("0", 64), "checksum mismatch"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := filepath.Join(t.TempDir(), "bin", "chezmoi")
+			err := installBinary(test.source, test.checksum, target)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("installBinary error = %v, want %q", err, test.wantErr)
+				}
+				if _, err := os.Stat(target); !os.IsNotExist(err) {
+					t.Errorf("chezmoi was installed despite the error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("installBinary: %v", err)
+			}
+			got, err := os.ReadFile(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(body) {
+				t.Errorf("installed %q, want %q", got, body)
+			}
+		})
+	}
+}
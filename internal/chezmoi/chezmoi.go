@@ -1,93 +1,209 @@
 package chezmoi
 
 import (
+	"bufio"
 	"fmt"
 	"os"
+	"strings"
 
-	"github.com/bayou-brogrammer/mygo/internal/config"
 	"github.com/bayou-brogrammer/mygo/internal/shell"
+	"github.com/bayou-brogrammer/mygo/internal/ui"
 )
 
+// InitOptions defines options for initializing chezmoi
+type InitOptions struct {
+	// Read template data from MILO_CHEZMOI_* environment variables instead of prompting
+	NonInteractive bool
+
+	// Show commands and their error output
+	Verbose bool
+}
+
+// ApplyOptions defines options for applying chezmoi configuration
+type ApplyOptions struct {
+	// Show the diff of each target and ask before applying it
+	Interactive bool
+
+	// Show commands and their error output
+	Verbose bool
+}
+
+// UpdateOptions defines options for updating chezmoi
+type UpdateOptions struct {
+	// Show commands and their error output
+	Verbose bool
+}
+
+// AddOptions defines options for adding files to chezmoi
+type AddOptions struct {
+	// Show commands and their error output
+	Verbose bool
+}
+
 // Init initializes chezmoi with an optional dotfiles repository
 func Init(repoURL string) error {
-	// Check if chezmoi is installed
-	if !shell.CommandExists("chezmoi") {
-		return fmt.Errorf("chezmoi is not installed, please install it first")
-	}
+	return InitWithOptions(repoURL, InitOptions{})
+}
 
-	cfg, err := config.GetConfig()
-	if err != nil {
-		return fmt.Errorf("failed to get config: %w", err)
+// InitWithOptions initializes chezmoi with an optional dotfiles repository and options
+func InitWithOptions(repoURL string, options InitOptions) error {
+	// Install chezmoi if needed
+	if err := BootstrapWithOptions(BootstrapOptions{Verbose: options.Verbose}); err != nil {
+		return err
 	}
 
 	// Initialize chezmoi
 	var result *shell.Result
+	var err error
 	if repoURL != "" {
 		// Initialize with repository
-		result, err = shell.Execute("chezmoi", "init", repoURL)
+		result, err = execute("init", repoURL)
 	} else {
 		// Initialize without repository
-		result, err = shell.Execute("chezmoi", "init")
+		result, err = execute("init")
 	}
 
 	if err != nil {
 		return fmt.Errorf("failed to initialize chezmoi: %w", err)
 	}
 
-	shell.PrintResult(result, true)
+	shell.PrintResult(result, options.Verbose)
 
-	// Update configuration
-	chezmoiDir, err := getChezmoiDir()
-	if err != nil {
+	// Make sure init left a usable source directory. It isn't saved as
+	// chezmoi_dir, so chezmoi keeps following sourceDir in its own config
+	if _, err := getChezmoiDir(); err != nil {
 		return fmt.Errorf("failed to get chezmoi directory: %w", err)
 	}
 
-	cfg.ChezmoiDir = chezmoiDir
-	if err := cfg.Save(); err != nil {
-		return fmt.Errorf("failed to save config: %w", err)
-	}
-
-	return nil
+	// Make sure the templates have the data they need
+	return ConfigureDataWithOptions(DataOptions{NonInteractive: options.NonInteractive})
 }
 
 // Apply applies chezmoi configuration to the system
 func Apply() error {
+	return ApplyWithOptions(ApplyOptions{})
+}
+
+// ApplyWithOptions applies chezmoi configuration to the system with options
+func ApplyWithOptions(options ApplyOptions) error {
 	// Check if chezmoi is installed
-	if !shell.CommandExists("chezmoi") {
+	if !Installed() {
 		return fmt.Errorf("chezmoi is not installed, please install it first")
 	}
 
+	if options.Interactive {
+		return applyInteractive(options)
+	}
+
 	// Apply configuration
-	result, err := shell.Execute("chezmoi", "apply")
+	result, err := execute("apply")
 	if err != nil {
 		return fmt.Errorf("failed to apply chezmoi configuration: %w", err)
 	}
 
-	shell.PrintResult(result, true)
+	shell.PrintResult(result, options.Verbose)
+	return nil
+}
+
+// applyInteractive shows the diff of each target and applies the ones the
+// user accepts
+func applyInteractive(options ApplyOptions) error {
+	diffs, err := Diff()
+	if err != nil {
+		return err
+	}
+
+	if len(diffs) == 0 {
+		fmt.Println("Nothing to apply")
+		return nil
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	var targets []string
+	all := false
+
+prompt:
+	for _, diff := range diffs {
+		if all {
+			targets = append(targets, diff.Target)
+			continue
+		}
+
+		ui.PrintSubtitle(diff.RelPath)
+		ui.PrintDiff(diff.Patch)
+
+		for {
+			fmt.Printf("Apply %s? [y]es, [n]o, [a]ll, [q]uit: ", diff.RelPath)
+			answer, err := reader.ReadString('\n')
+			if err != nil && answer == "" {
+				// Stop asking once input is closed
+				break prompt
+			}
+
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "y", "yes":
+				targets = append(targets, diff.Target)
+			case "a", "all":
+				targets = append(targets, diff.Target)
+				all = true
+			case "n", "no", "":
+			case "q", "quit":
+				break prompt
+			default:
+				continue
+			}
+			break
+		}
+	}
+
+	if len(targets) == 0 {
+		fmt.Println("No targets applied")
+		return nil
+	}
+
+	// The user already reviewed each target, so don't let chezmoi ask again
+	args := append([]string{"apply", "--force"}, targets...)
+	result, err := execute(args...)
+	if err != nil {
+		return fmt.Errorf("failed to apply chezmoi configuration: %w", withStderr(result, err))
+	}
+
+	shell.PrintResult(result, options.Verbose)
+	fmt.Printf("Applied %d of %d targets\n", len(targets), len(diffs))
 	return nil
 }
 
 // Update updates chezmoi-managed files from the source repository
 func Update() error {
+	return UpdateWithOptions(UpdateOptions{})
+}
+
+// UpdateWithOptions updates chezmoi-managed files from the source repository with options
+func UpdateWithOptions(options UpdateOptions) error {
 	// Check if chezmoi is installed
-	if !shell.CommandExists("chezmoi") {
+	if !Installed() {
 		return fmt.Errorf("chezmoi is not installed, please install it first")
 	}
 
 	// Update source repository
-	result, err := shell.Execute("chezmoi", "update")
+	result, err := execute("update")
 	if err != nil {
 		return fmt.Errorf("failed to update chezmoi: %w", err)
 	}
 
-	shell.PrintResult(result, true)
+	shell.PrintResult(result, options.Verbose)
 	return nil
 }
 
 // Add adds a file to be managed by chezmoi
 func Add(filePath string) error {
+	return AddWithOptions(filePath, AddOptions{})
+}
+
+// AddWithOptions adds a file to be managed by chezmoi with options
+func AddWithOptions(filePath string, options AddOptions) error {
 	// Check if chezmoi is installed
-	if !shell.CommandExists("chezmoi") {
+	if !Installed() {
 		return fmt.Errorf("chezmoi is not installed, please install it first")
 	}
 
@@ -97,21 +213,11 @@ func Add(filePath string) error {
 	}
 
 	// Add file to chezmoi
-	result, err := shell.Execute("chezmoi", "add", filePath)
+	result, err := execute("add", filePath)
 	if err != nil {
 		return fmt.Errorf("failed to add file to chezmoi: %w", err)
 	}
 
-	shell.PrintResult(result, true)
+	shell.PrintResult(result, options.Verbose)
 	return nil
 }
-
-// getChezmoiDir gets the chezmoi source directory
-func getChezmoiDir() (string, error) {
-	result, err := shell.Execute("chezmoi", "source-path")
-	if err != nil {
-		return "", fmt.Errorf("failed to get chezmoi source path: %w", err)
-	}
-
-	return result.Stdout, nil
-}
@@ -0,0 +1,887 @@
+package chezmoi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/shell"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// DataEnvPrefix prefixes the environment variables that provide template data
+// in non-interactive mode, such as MILO_CHEZMOI_EMAIL for .email
+const DataEnvPrefix = "MILO_CHEZMOI_"
+
+// Profiles are the valid values of the profile template variable
+var Profiles = []string{"personal", "work"}
+
+// dataPrompt is a template variable milo always asks for
+type dataPrompt struct {
+	Key     string
+	Prompt  string
+	Default string
+}
+
+// dataPrompts are asked for on every machine, in order
+var dataPrompts = []dataPrompt{
+	{Key: "email", Prompt: "Email address"},
+	{Key: "profile", Prompt: "Profile (personal or work)", Default: "personal"},
+	{Key: "role", Prompt: "Machine role (desktop, laptop or server)", Default: "desktop"},
+}
+
+// DataOptions defines options for configuring chezmoi template data
+type DataOptions struct {
+	// Run in non-interactive mode, using environment variables instead of prompts
+	NonInteractive bool
+}
+
+// ConfigureData makes sure every variable the source templates use is defined
+func ConfigureData() error {
+	return ConfigureDataWithOptions(DataOptions{})
+}
+
+// ConfigureDataWithOptions asks for template data that is missing from the
+// milo config, saves it and merges it into the data section of chezmoi's
+// config file. Values already in chezmoi's config are adopted rather than
+// asked for again. In non-interactive mode values come from MILO_CHEZMOI_*
+// environment variables, which take precedence over the milo config.
+func ConfigureDataWithOptions(options DataOptions) error {
+	// Check if chezmoi is installed
+	if !Installed() {
+		return fmt.Errorf("chezmoi is not installed, please install it first")
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+
+	sourceDir, err := getChezmoiDir()
+	if err != nil {
+		return fmt.Errorf("failed to get chezmoi directory: %w", err)
+	}
+
+	referenced, err := TemplateVars(sourceDir)
+	if err != nil {
+		return err
+	}
+
+	configPath, err := chezmoiConfigPath()
+	if err != nil {
+		return err
+	}
+
+	chezmoiConfig, err := readDataFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read chezmoi config: %w", err)
+	}
+	existing, _ := chezmoiConfig["data"].(map[string]any)
+
+	sourceData, err := sourceDataKeys(sourceDir)
+	if err != nil {
+		return err
+	}
+
+	// Variables milo asks for, followed by the other referenced ones
+	prompts := slices.Clone(dataPrompts)
+	for _, key := range referenced {
+		known := sourceData[key] || slices.ContainsFunc(prompts, func(p dataPrompt) bool {
+			return p.Key == key
+		})
+		if !known {
+			prompts = append(prompts, dataPrompt{Key: key, Prompt: fmt.Sprintf("Value for .%s", key)})
+		}
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	var missing []string
+	for _, p := range prompts {
+		key := p.Key
+		value, ok := cfg.ChezmoiData[key]
+
+		if !ok {
+			if adopted, isString := existing[p.Key].(string); isString {
+				value, ok = adopted, true
+			}
+		}
+
+		if options.NonInteractive {
+			if env, set := os.LookupEnv(dataEnvName(p.Key)); set {
+				value, ok = env, true
+			}
+			if !ok {
+				missing = append(missing, dataEnvName(p.Key))
+				continue
+			}
+		} else if !ok {
+			value, ok = askData(reader, p)
+			if !ok {
+				missing = append(missing, p.Key)
+				continue
+			}
+		}
+
+		if err := validateData(key, value); err != nil {
+			return err
+		}
+		cfg.ChezmoiData[key] = value
+	}
+
+	if len(missing) > 0 {
+		if options.NonInteractive {
+			return fmt.Errorf("in non-interactive mode, %s environment variables must be set", strings.Join(missing, ", "))
+		}
+		return fmt.Errorf("template data is missing: %s", strings.Join(missing, ", "))
+	}
+
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	return writeData(configPath, cfg.ChezmoiData)
+}
+
+// SetData sets a template variable in the milo config and chezmoi's config
+func SetData(key, value string) error {
+	if !regexp.MustCompile(`^[A-Za-z_]\w*$`).MatchString(key) {
+		return fmt.Errorf("invalid template variable name: %s", key)
+	}
+	if err := validateData(key, value); err != nil {
+		return err
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+
+	cfg.ChezmoiData[key] = value
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	configPath, err := chezmoiConfigPath()
+	if err != nil {
+		return err
+	}
+
+	return writeData(configPath, cfg.ChezmoiData)
+}
+
+// UndefinedVars returns the variables the source templates use that neither
+// milo, chezmoi's config nor the source's .chezmoidata files define
+func UndefinedVars() ([]string, error) {
+	// Check if chezmoi is installed
+	if !Installed() {
+		return nil, fmt.Errorf("chezmoi is not installed, please install it first")
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+
+	sourceDir, err := getChezmoiDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chezmoi directory: %w", err)
+	}
+
+	referenced, err := TemplateVars(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	configPath, err := chezmoiConfigPath()
+	if err != nil {
+		return nil, err
+	}
+
+	chezmoiConfig, err := readDataFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chezmoi config: %w", err)
+	}
+	existing, _ := chezmoiConfig["data"].(map[string]any)
+
+	sourceData, err := sourceDataKeys(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var undefined []string
+	for _, key := range referenced {
+		_, inMilo := cfg.ChezmoiData[key]
+		_, inChezmoi := existing[key]
+		if !inMilo && !inChezmoi && !sourceData[key] {
+			undefined = append(undefined, key)
+		}
+	}
+
+	return undefined, nil
+}
+
+// actionPattern matches template actions
+var actionPattern = regexp.MustCompile(`(?s)\{\{-?(.*?)-?\}\}`)
+
+// stringPattern matches string literals in template actions
+var stringPattern = regexp.MustCompile("\"(?:[^\"\\\\]|\\\\.)*\"|`[^`]*`")
+
+// fieldPattern matches top-level field references such as .email, but not
+// $var.field, chained .a.b fields or method calls on results
+var fieldPattern = regexp.MustCompile(`(?:^|[^\w$.)\]])\.([A-Za-z_]\w*)`)
+
+// TemplateVars returns the top-level data variables the templates in the
+// chezmoi source directory reference, sorted by name. References inside range,
+// with and define blocks are skipped because the dot changes meaning there.
+func TemplateVars(sourceDir string) ([]string, error) {
+	vars := make(map[string]bool)
+
+	err := filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := info.Name()
+		if info.IsDir() {
+			if name == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		relPath, err := filepath.Rel(sourceDir, path)
+		if err != nil {
+			return err
+		}
+
+		if !isTemplate(filepath.ToSlash(relPath), name) {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range templateFields(string(data)) {
+			vars[key] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chezmoi templates: %w", err)
+	}
+
+	// Built-in variables are always defined
+	delete(vars, "chezmoi")
+
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys, nil
+}
+
+// isTemplate reports whether chezmoi executes a source file as a template
+func isTemplate(relPath, name string) bool {
+	switch {
+	case strings.HasPrefix(name, ".chezmoi.") && strings.HasSuffix(name, ".tmpl"):
+		// The config file template runs before any data exists
+		return false
+	case strings.HasPrefix(relPath, ".chezmoitemplates/"):
+		return true
+	case name == ".chezmoiignore", name == ".chezmoiremove", strings.HasPrefix(name, ".chezmoiexternal."):
+		return true
+	default:
+		return strings.HasSuffix(name, ".tmpl")
+	}
+}
+
+// templateFields returns the top-level fields a template references
+func templateFields(text string) []string {
+	var fields []string
+
+	// Whether each open block changes the dot
+	var blocks []bool
+	scoped := func() bool {
+		return slices.Contains(blocks, true)
+	}
+
+	for _, match := range actionPattern.FindAllStringSubmatch(text, -1) {
+		action := strings.TrimSpace(match[1])
+		if strings.HasPrefix(action, "/*") {
+			continue
+		}
+		action = stringPattern.ReplaceAllString(action, `""`)
+
+		if !scoped() {
+			for _, field := range fieldPattern.FindAllStringSubmatch(action, -1) {
+				fields = append(fields, field[1])
+			}
+		}
+
+		keyword, _, _ := strings.Cut(action, " ")
+		switch keyword {
+		case "range", "with", "define":
+			blocks = append(blocks, true)
+		case "if", "block":
+			blocks = append(blocks, false)
+		case "end":
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+		}
+	}
+
+	return fields
+}
+
+// sourceDataKeys returns the top-level keys of the .chezmoidata files in the
+// source directory
+func sourceDataKeys(sourceDir string) (map[string]bool, error) {
+	paths, err := filepath.Glob(filepath.Join(sourceDir, ".chezmoidata.*"))
+	if err != nil {
+		return nil, err
+	}
+	more, err := filepath.Glob(filepath.Join(sourceDir, ".chezmoidata", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool)
+	for _, path := range append(paths, more...) {
+		data, err := readDataFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		for key := range data {
+			keys[key] = true
+		}
+	}
+
+	return keys, nil
+}
+
+// chezmoiConfigPath returns the path of chezmoi's config file, preferring an
+// existing file in any format chezmoi reads
+func chezmoiConfigPath() (string, error) {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		configDir = filepath.Join(homeDir, ".config")
+	}
+
+	dir := filepath.Join(configDir, "chezmoi")
+	for _, ext := range []string{".toml", ".yaml", ".yml", ".json"} {
+		path := filepath.Join(dir, "chezmoi"+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+
+	return filepath.Join(dir, "chezmoi.toml"), nil
+}
+
+// readDataFile decodes a TOML, YAML or JSON file by its extension. A missing
+// file decodes to an empty map.
+func readDataFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string]any{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]any{}
+	switch filepath.Ext(path) {
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".json":
+		err = json.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("unsupported file format: %s", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if values == nil {
+		values = map[string]any{}
+	}
+	return values, nil
+}
+
+// writeData sets the milo template data in the data section of chezmoi's
+// config. Only that section changes: comments, key order and everything else
+// in the file are kept as they are.
+func writeData(path string, values map[string]string) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read chezmoi config: %w", err)
+	}
+
+	var updated []byte
+	switch filepath.Ext(path) {
+	case ".toml":
+		updated, err = setTOMLData(content, values)
+	case ".yaml", ".yml":
+		updated, err = setYAMLData(content, values, false)
+	case ".json":
+		updated, err = setYAMLData(content, values, true)
+	default:
+		return fmt.Errorf("unsupported file format: %s", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update data in %s: %w", path, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to write chezmoi config: %w", err)
+	}
+
+	// The config often holds secrets, so a new file is private
+	perm := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	if err := os.WriteFile(path, updated, perm); err != nil {
+		return fmt.Errorf("failed to write chezmoi config: %w", err)
+	}
+
+	return nil
+}
+
+// setTOMLData sets values in the [data] table of a TOML document by editing
+// its lines, adding the table if there is none
+func setTOMLData(content []byte, values map[string]string) ([]byte, error) {
+	lines := strings.Split(string(content), "\n")
+
+	// The table runs from its header to the next header
+	start, end := -1, len(lines)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "[") {
+			continue
+		}
+		if start >= 0 {
+			end = i
+			break
+		}
+		if slices.Equal(tomlTable(trimmed), []string{"data"}) {
+			start = i
+		}
+	}
+
+	if start < 0 {
+		existing := map[string]any{}
+		if err := toml.Unmarshal(content, &existing); err != nil {
+			return nil, err
+		}
+		if _, ok := existing["data"]; ok {
+			return nil, fmt.Errorf("data is not defined as a [data] table")
+		}
+
+		// Drop the trailing newline, it is added back below
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "[data]")
+		start, end = len(lines)-1, len(lines)
+		lines = append(lines, "")
+	}
+
+	set := make(map[string]bool)
+	indent := ""
+	for i := start + 1; i < end; i++ {
+		key, ok := tomlKey(lines[i])
+		if !ok {
+			continue
+		}
+		indent = lines[i][:len(lines[i])-len(strings.TrimLeft(lines[i], " \t"))]
+
+		value, wanted := values[key]
+		if !wanted {
+			continue
+		}
+
+		line, err := tomlLine(key, value)
+		if err != nil {
+			return nil, err
+		}
+		if comment := tomlComment(lines[i]); comment != "" {
+			line += " " + comment
+		}
+		lines[i] = indent + line
+		set[key] = true
+	}
+
+	// New keys go after the last line of the table that isn't blank
+	last := end
+	for last > start+1 && strings.TrimSpace(lines[last-1]) == "" {
+		last--
+	}
+
+	var added []string
+	for _, key := range sortedKeys(values) {
+		if set[key] {
+			continue
+		}
+		line, err := tomlLine(key, values[key])
+		if err != nil {
+			return nil, err
+		}
+		added = append(added, indent+line)
+	}
+	lines = slices.Insert(lines, last, added...)
+
+	updated := []byte(strings.Join(lines, "\n"))
+
+	// Make sure the edit did what it should before the file is replaced
+	check := map[string]any{}
+	if err := toml.Unmarshal(updated, &check); err != nil {
+		return nil, err
+	}
+	data, _ := check["data"].(map[string]any)
+	for key, value := range values {
+		if data[key] != value {
+			return nil, fmt.Errorf("failed to set %s, edit the [data] table by hand", key)
+		}
+	}
+
+	return updated, nil
+}
+
+// tomlTable returns the key path of the table a header line such as [data]
+// opens, or nil for array tables
+func tomlTable(header string) []string {
+	if !strings.HasPrefix(header, "[") || strings.HasPrefix(header, "[[") {
+		return nil
+	}
+	path, ok := tomlKeyPath(header[1:], ']')
+	if !ok {
+		return nil
+	}
+	return path
+}
+
+// tomlKey returns the unquoted key a key/value line sets. Dotted keys such as
+// user.name set a key in a nested table and are not returned.
+func tomlKey(line string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return "", false
+	}
+
+	path, ok := tomlKeyPath(trimmed, '=')
+	if !ok || len(path) != 1 {
+		return "", false
+	}
+	return path[0], true
+}
+
+// tomlKeyPath splits the dotted key at the start of text, up to the first
+// stop byte outside quotes, into its unquoted parts
+func tomlKeyPath(text string, stop byte) ([]string, bool) {
+	var path []string
+	var part strings.Builder
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+				continue
+			}
+			if c == '\\' && quote == '"' && i+1 < len(text) {
+				i++
+				c = text[i]
+			}
+			part.WriteByte(c)
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '.' || c == stop:
+			path = append(path, strings.TrimSpace(part.String()))
+			part.Reset()
+			if c == stop {
+				return path, true
+			}
+		default:
+			part.WriteByte(c)
+		}
+	}
+
+	return nil, false
+}
+
+// tomlComment returns the comment at the end of a key/value line whose value
+// is a string or a bare value
+func tomlComment(line string) string {
+	_, value, _ := strings.Cut(line, "=")
+	value = strings.TrimSpace(value)
+
+	// Skip past a quoted value, whose text may contain #
+	end := 0
+	switch {
+	case strings.HasPrefix(value, `"`):
+		for end = 1; end < len(value) && value[end] != '"'; end++ {
+			if value[end] == '\\' {
+				end++
+			}
+		}
+	case strings.HasPrefix(value, "'"):
+		end = strings.IndexByte(value[1:], '\'') + 1
+		if end == 0 {
+			end = len(value)
+		}
+	}
+	if end >= len(value) {
+		return ""
+	}
+
+	if i := strings.IndexByte(value[end:], '#'); i >= 0 {
+		return value[end+i:]
+	}
+	return ""
+}
+
+// tomlLine encodes a single string key/value line
+func tomlLine(key, value string) (string, error) {
+	encoded, err := toml.Marshal(map[string]string{key: value})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(encoded)), nil
+}
+
+// setYAMLData sets values in the data mapping of a YAML or JSON document,
+// keeping comments and the order of keys
+func setYAMLData(content []byte, values map[string]string, asJSON bool) ([]byte, error) {
+	doc, err := parseYAMLMapping(content)
+	if err != nil {
+		return nil, err
+	}
+	root := doc.Content[0]
+
+	data := mappingValue(root, "data")
+	if data == nil {
+		data = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		root.Content = append(root.Content, stringNode("data"), data)
+	}
+	if data.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("data is not a mapping")
+	}
+
+	for _, key := range sortedKeys(values) {
+		if node := mappingValue(data, key); node != nil {
+			value := stringNode(values[key])
+			value.HeadComment, value.LineComment, value.FootComment = node.HeadComment, node.LineComment, node.FootComment
+			*node = *value
+			continue
+		}
+		data.Content = append(data.Content, stringNode(key), stringNode(values[key]))
+	}
+
+	return encodeYAML(doc, asJSON)
+}
+
+// parseYAMLMapping parses a YAML or JSON document whose root is a mapping. An
+// empty document parses as an empty mapping.
+func parseYAMLMapping(content []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("document is not a mapping")
+	}
+	return &doc, nil
+}
+
+// encodeYAML encodes a document as YAML, or as indented JSON
+func encodeYAML(doc *yaml.Node, asJSON bool) ([]byte, error) {
+	var buf bytes.Buffer
+	if asJSON {
+		if err := writeJSON(&buf, doc.Content[0], ""); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\n")
+		return buf.Bytes(), nil
+	}
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// stringNode returns a scalar node holding a string
+func stringNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// writeJSON encodes a node as indented JSON, keeping the order of keys
+func writeJSON(buf *bytes.Buffer, node *yaml.Node, indent string) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("{}")
+			return nil
+		}
+		buf.WriteString("{\n")
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, err := json.Marshal(node.Content[i].Value)
+			if err != nil {
+				return err
+			}
+			buf.WriteString(indent + "  " + string(key) + ": ")
+			if err := writeJSON(buf, node.Content[i+1], indent+"  "); err != nil {
+				return err
+			}
+			if i+2 < len(node.Content) {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "}")
+	case yaml.SequenceNode:
+		if len(node.Content) == 0 {
+			buf.WriteString("[]")
+			return nil
+		}
+		buf.WriteString("[\n")
+		for i, item := range node.Content {
+			buf.WriteString(indent + "  ")
+			if err := writeJSON(buf, item, indent+"  "); err != nil {
+				return err
+			}
+			if i+1 < len(node.Content) {
+				buf.WriteString(",")
+			}
+			buf.WriteString("\n")
+		}
+		buf.WriteString(indent + "]")
+	case yaml.ScalarNode:
+		if node.Tag != "!!str" {
+			// Numbers, booleans and null are written as they are
+			buf.WriteString(node.Value)
+			return nil
+		}
+		value, err := json.Marshal(node.Value)
+		if err != nil {
+			return err
+		}
+		buf.Write(value)
+	default:
+		return fmt.Errorf("unsupported JSON value")
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of values in order
+func sortedKeys(values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// validateData checks the value of a template variable milo knows about
+func validateData(key, value string) error {
+	if key == "profile" && !slices.Contains(Profiles, value) {
+		return fmt.Errorf("invalid profile %q, must be one of: %s", value, strings.Join(Profiles, ", "))
+	}
+	if key == "email" && value != "" && !strings.Contains(value, "@") {
+		return fmt.Errorf("invalid email address: %s", value)
+	}
+	return nil
+}
+
+// dataEnvName returns the environment variable for a template variable
+func dataEnvName(key string) string {
+	return DataEnvPrefix + strings.ToUpper(key)
+}
+
+// defaultValue returns the value used when the prompt is left empty
+func (p dataPrompt) defaultValue() string {
+	if p.Key != "email" {
+		return p.Default
+	}
+
+	// Suggest the email git commits with
+	result, err := shell.Execute("git", "config", "--global", "user.email")
+	if err != nil {
+		return p.Default
+	}
+	return strings.TrimSpace(result.Stdout)
+}
+
+// askData prompts until a valid value is given for a template variable. It
+// returns false if input ends first.
+func askData(reader *bufio.Reader, p dataPrompt) (string, bool) {
+	def := p.defaultValue()
+	for {
+		if def != "" {
+			fmt.Printf("%s [%s]: ", p.Prompt, def)
+		} else {
+			fmt.Printf("%s: ", p.Prompt)
+		}
+
+		answer, err := reader.ReadString('\n')
+		value := strings.TrimSpace(answer)
+		if value == "" {
+			value = def
+		}
+
+		if value != "" {
+			verr := validateData(p.Key, value)
+			if verr == nil {
+				return value, true
+			}
+			fmt.Println(verr)
+		}
+
+		if err != nil {
+			return "", false
+		}
+	}
+}
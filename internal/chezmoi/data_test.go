@@ -0,0 +1,268 @@
+package chezmoi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetTOMLData(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		values  map[string]string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "existing table",
+			content: `# chezmoi config
+[data]
+    # who I am
+    email = "old@example.com" # work address
+    editor = "vim"
+
+[git]
+    autoCommit = true
+`,
+			values: map[string]string{"email": "new@example.com", "Profile": "work"},
+			want: `# chezmoi config
+[data]
+    # who I am
+    email = 'new@example.com' # work address
+    editor = "vim"
+    Profile = 'work'
+
+[git]
+    autoCommit = true
+`,
+		},
+		{
+			name: "missing table",
+			content: `sourceDir = "~/dotfiles" # kept
+
+[edit]
+command = "nvim"
+`,
+			values: map[string]string{"email": "me@example.com"},
+			want: `sourceDir = "~/dotfiles" # kept
+
+[edit]
+command = "nvim"
+
+[data]
+email = 'me@example.com'
+`,
+		},
+		{
+			name:    "empty file",
+			content: "",
+			values:  map[string]string{"email": "me@example.com"},
+			want: `[data]
+email = 'me@example.com'
+`,
+		},
+		{
+			name: "quoted keys",
+			content: `[data]
+"git.email" = "old@example.com"
+'full name' = "Old Name" # literal key
+`,
+			values: map[string]string{"git.email": "new@example.com", "full name": "New Name", "new key": "x"},
+			want: `[data]
+'git.email' = 'new@example.com'
+'full name' = 'New Name' # literal key
+'new key' = 'x'
+`,
+		},
+		{
+			name: "dotted keys are left alone",
+			content: `[data]
+user.name = "Me"
+email = "old@example.com"
+`,
+			values: map[string]string{"email": "new@example.com"},
+			want: `[data]
+user.name = "Me"
+email = 'new@example.com'
+`,
+		},
+		{
+			name: "dotted key is not a flat key",
+			content: `[data]
+user.name = "Me"
+`,
+			values: map[string]string{"user.name": "You"},
+			want: `[data]
+user.name = "Me"
+'user.name' = 'You'
+`,
+		},
+		{
+			name: "other tables keep their keys",
+			content: `[diff]
+email = "not data"
+
+[data]
+email = "old@example.com"
+
+[data.nested]
+email = "nested"
+`,
+			values: map[string]string{"email": "new@example.com", "name": "Me"},
+			want: `[diff]
+email = "not data"
+
+[data]
+email = 'new@example.com'
+name = 'Me'
+
+[data.nested]
+email = "nested"
+`,
+		},
+		{
+			name: "comment with hash in value",
+			content: `[data]
+url = "https://example.com/#anchor" # docs
+`,
+			values: map[string]string{"url": "https://example.org"},
+			want: `[data]
+url = 'https://example.org' # docs
+`,
+		},
+		{
+			name:    "data defined inline",
+			content: "data = { email = \"me@example.com\" }\n",
+			values:  map[string]string{"email": "new@example.com"},
+			wantErr: "not defined as a [data] table",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := setTOMLData([]byte(test.content), test.values)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("setTOMLData error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setTOMLData: %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("setTOMLData =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSetYAMLData(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		values  map[string]string
+		asJSON  bool
+		want    string
+		wantErr string
+	}{
+		{
+			name: "existing mapping",
+			content: `# chezmoi config
+data:
+  # who I am
+  email: old@example.com # work address
+  editor: vim
+git:
+  autoCommit: true
+`,
+			values: map[string]string{"email": "new@example.com", "Profile": "work"},
+			want: `# chezmoi config
+data:
+  # who I am
+  email: new@example.com # work address
+  editor: vim
+  Profile: work
+git:
+  autoCommit: true
+`,
+		},
+		{
+			name: "missing mapping",
+			content: `sourceDir: ~/dotfiles # kept
+`,
+			values: map[string]string{"email": "me@example.com"},
+			want: `sourceDir: ~/dotfiles # kept
+data:
+  email: me@example.com
+`,
+		},
+		{
+			name:    "empty file",
+			content: "",
+			values:  map[string]string{"email": "me@example.com"},
+			want: `data:
+  email: me@example.com
+`,
+		},
+		{
+			name: "quoted and dotted keys",
+			content: `data:
+  "git.email": old@example.com
+  user:
+    name: Me
+`,
+			values: map[string]string{"git.email": "new@example.com", "user.name": "You"},
+			want: `data:
+  "git.email": new@example.com
+  user:
+    name: Me
+  user.name: You
+`,
+		},
+		{
+			name: "json",
+			content: `{
+  "sourceDir": "~/dotfiles",
+  "data": {
+    "email": "old@example.com"
+  }
+}
+`,
+			values: map[string]string{"email": "new@example.com", "Name": "Me"},
+			asJSON: true,
+			want: `{
+  "sourceDir": "~/dotfiles",
+  "data": {
+    "email": "new@example.com",
+    "Name": "Me"
+  }
+}
+`,
+		},
+		{
+			name:    "data is not a mapping",
+			content: "data: [a, b]\n",
+			values:  map[string]string{"email": "me@example.com"},
+			wantErr: "data is not a mapping",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := setYAMLData([]byte(test.content), test.values, test.asJSON)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("setYAMLData error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setYAMLData: %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("setYAMLData =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
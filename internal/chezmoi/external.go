@@ -0,0 +1,439 @@
+package chezmoi
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ExternalArchive unpacks an archive into the target directory
+	ExternalArchive = "archive"
+
+	// ExternalGitRepo clones a git repository into the target directory
+	ExternalGitRepo = "git-repo"
+)
+
+// ExternalTypes are the external types milo manages
+var ExternalTypes = []string{ExternalArchive, ExternalGitRepo}
+
+// External is an entry in the source directory's .chezmoiexternal file
+type External struct {
+	// Target path relative to the destination directory
+	Path string
+
+	// One of ExternalTypes, or another type chezmoi supports
+	Type string
+
+	URL string
+
+	// Remove files in the target that aren't in the archive
+	Exact bool
+
+	// Leading path components to strip from archive entries
+	StripComponents int
+
+	// How often chezmoi downloads or pulls the external again, such as "168h"
+	RefreshPeriod string
+}
+
+// validate checks that chezmoi can use the external
+func (e External) validate() error {
+	if !slices.Contains(ExternalTypes, e.Type) {
+		return fmt.Errorf("invalid external type %q, must be one of: %s", e.Type, strings.Join(ExternalTypes, ", "))
+	}
+
+	parsed, err := url.Parse(e.URL)
+	if err != nil || e.URL == "" {
+		return fmt.Errorf("invalid external URL: %q", e.URL)
+	}
+	if parsed.Scheme == "" && !strings.Contains(e.URL, "@") {
+		return fmt.Errorf("external URL needs a scheme: %s", e.URL)
+	}
+
+	if e.Type == ExternalGitRepo && (e.Exact || e.StripComponents != 0) {
+		return fmt.Errorf("exact and strip components only apply to archives")
+	}
+	if e.StripComponents < 0 {
+		return fmt.Errorf("strip components can't be negative")
+	}
+
+	if e.RefreshPeriod != "" {
+		if _, err := time.ParseDuration(e.RefreshPeriod); err != nil {
+			return fmt.Errorf("invalid refresh period %q: %w", e.RefreshPeriod, err)
+		}
+	}
+
+	return nil
+}
+
+// fields returns the external as the keys chezmoi reads
+func (e External) fields() map[string]any {
+	fields := map[string]any{
+		"type": e.Type,
+		"url":  e.URL,
+	}
+	if e.Exact {
+		fields["exact"] = true
+	}
+	if e.StripComponents > 0 {
+		fields["stripComponents"] = e.StripComponents
+	}
+	if e.RefreshPeriod != "" {
+		fields["refreshPeriod"] = e.RefreshPeriod
+	}
+	return fields
+}
+
+// externalFromFields reads an external from the keys chezmoi reads
+func externalFromFields(path string, fields map[string]any) External {
+	external := External{Path: path}
+	external.Type, _ = fields["type"].(string)
+	external.URL, _ = fields["url"].(string)
+	external.Exact, _ = fields["exact"].(bool)
+	external.RefreshPeriod, _ = fields["refreshPeriod"].(string)
+
+	switch n := fields["stripComponents"].(type) {
+	case int:
+		external.StripComponents = n
+	case int64:
+		external.StripComponents = int(n)
+	case float64:
+		external.StripComponents = int(n)
+	}
+
+	return external
+}
+
+// Externals returns the entries of the .chezmoiexternal file sorted by path
+func Externals() ([]External, error) {
+	path, values, err := readExternals()
+	if err != nil {
+		return nil, err
+	}
+
+	externals := make([]External, 0, len(values))
+	for target, entry := range values {
+		fields, ok := entry.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("invalid entry %s in %s", target, path)
+		}
+		externals = append(externals, externalFromFields(target, fields))
+	}
+
+	sort.Slice(externals, func(i, j int) bool {
+		return externals[i].Path < externals[j].Path
+	})
+
+	return externals, nil
+}
+
+// AddExternal adds an external to the .chezmoiexternal file, replacing an
+// existing entry for the same path
+func AddExternal(external External) error {
+	target, err := externalPath(external.Path)
+	if err != nil {
+		return err
+	}
+	external.Path = target
+
+	if err := external.validate(); err != nil {
+		return err
+	}
+
+	path, _, err := readExternals()
+	if err != nil {
+		return err
+	}
+
+	if err := writeExternal(path, external.Path, external.fields()); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// RemoveExternal removes the external for a target path
+func RemoveExternal(target string) error {
+	target, err := externalPath(target)
+	if err != nil {
+		return err
+	}
+
+	path, values, err := readExternals()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := values[target]; !ok {
+		return fmt.Errorf("no external for %s", target)
+	}
+
+	if err := writeExternal(path, target, nil); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// readExternals reads the .chezmoiexternal file of the source directory. A
+// missing file reads as empty and is created as TOML. Templated files are
+// refused, because editing them could break the template.
+func readExternals() (string, map[string]any, error) {
+	// Check if chezmoi is installed
+	if !Installed() {
+		return "", nil, fmt.Errorf("chezmoi is not installed, please install it first")
+	}
+
+	sourceDir, err := getChezmoiDir()
+	if err != nil {
+		return "", nil, err
+	}
+
+	templates, err := filepath.Glob(filepath.Join(sourceDir, ".chezmoiexternal.*.tmpl"))
+	if err != nil {
+		return "", nil, err
+	}
+	if len(templates) > 0 {
+		return "", nil, fmt.Errorf("%s is a template, edit it by hand", templates[0])
+	}
+
+	path := filepath.Join(sourceDir, ".chezmoiexternal.toml")
+	for _, ext := range []string{".toml", ".yaml", ".yml", ".json"} {
+		candidate := filepath.Join(sourceDir, ".chezmoiexternal"+ext)
+		if _, err := os.Stat(candidate); err == nil {
+			path = candidate
+			break
+		}
+	}
+
+	values, err := readDataFile(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return path, values, nil
+}
+
+// writeExternal replaces the entry for target in the .chezmoiexternal file
+// at path with fields, or removes it when fields is nil. Only that entry
+// changes: comments and the other entries are kept as they are.
+func writeExternal(path, target string, fields map[string]any) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var updated []byte
+	switch filepath.Ext(path) {
+	case ".toml":
+		updated, err = setTOMLEntry(content, target, fields)
+	case ".yaml", ".yml":
+		updated, err = setYAMLEntry(content, target, fields, false)
+	case ".json":
+		updated, err = setYAMLEntry(content, target, fields, true)
+	default:
+		return fmt.Errorf("unsupported file format: %s", path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	return os.WriteFile(path, updated, perm)
+}
+
+// setTOMLEntry replaces or removes the table of one entry in a TOML document
+// by editing its lines. A new entry is added at the end.
+func setTOMLEntry(content []byte, key string, fields map[string]any) ([]byte, error) {
+	lines := strings.Split(string(content), "\n")
+
+	// The entry runs from its header to the next header that isn't one of its
+	// sub-tables, such as [".oh-my-zsh".filter]
+	start, end := -1, len(lines)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "[") {
+			continue
+		}
+		table := tomlTable(trimmed)
+		if start < 0 {
+			if len(table) == 1 && table[0] == key {
+				start = i
+			}
+			continue
+		}
+		if len(table) < 2 || table[0] != key {
+			end = i
+			break
+		}
+	}
+
+	existing := map[string]any{}
+	if err := toml.Unmarshal(content, &existing); err != nil {
+		return nil, err
+	}
+	if _, ok := existing[key]; ok && start < 0 {
+		return nil, fmt.Errorf("%s is not defined as a table, edit the file by hand", key)
+	}
+
+	var block []string
+	if fields != nil {
+		encoded, err := toml.Marshal(map[string]any{key: fields})
+		if err != nil {
+			return nil, err
+		}
+		block = strings.Split(strings.TrimSpace(string(encoded)), "\n")
+	}
+
+	switch {
+	case start >= 0:
+		// Blank lines and comments before the next table belong to it
+		last := end
+		for last > start+1 && tomlFiller(lines[last-1]) {
+			last--
+		}
+		if fields != nil {
+			// Keep the header with its comment and the indentation of the keys
+			indent := ""
+			if start+1 < last {
+				indent = lines[start+1][:len(lines[start+1])-len(strings.TrimLeft(lines[start+1], " \t"))]
+			}
+			block[0] = lines[start]
+			for i := 1; i < len(block); i++ {
+				block[i] = indent + block[i]
+			}
+		} else {
+			// The comments right above the header go with the entry, and so
+			// does one of the blank lines around it
+			for start > 0 && strings.HasPrefix(strings.TrimSpace(lines[start-1]), "#") {
+				start--
+			}
+			if start > 0 && strings.TrimSpace(lines[start-1]) == "" {
+				start--
+			} else {
+				for last < end && last < len(lines)-1 && strings.TrimSpace(lines[last]) == "" {
+					last++
+				}
+			}
+		}
+		lines = slices.Replace(lines, start, last, block...)
+	case fields != nil:
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(append(lines, block...), "")
+	}
+
+	updated := []byte(strings.Join(lines, "\n"))
+
+	// Make sure the edit did what it should before the file is replaced
+	check := map[string]any{}
+	if err := toml.Unmarshal(updated, &check); err != nil {
+		return nil, err
+	}
+	if err := checkEntry(check, key, fields); err != nil {
+		return nil, err
+	}
+
+	return updated, nil
+}
+
+// tomlFiller reports whether a line is blank or only a comment
+func tomlFiller(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || strings.HasPrefix(trimmed, "#")
+}
+
+// setYAMLEntry replaces or removes one entry of a YAML or JSON document,
+// keeping comments and the order of the other entries
+func setYAMLEntry(content []byte, key string, fields map[string]any, asJSON bool) ([]byte, error) {
+	doc, err := parseYAMLMapping(content)
+	if err != nil {
+		return nil, err
+	}
+	root := doc.Content[0]
+
+	index := -1
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == key {
+			index = i
+			break
+		}
+	}
+
+	switch {
+	case fields == nil && index >= 0:
+		root.Content = slices.Delete(root.Content, index, index+2)
+	case fields != nil:
+		var value yaml.Node
+		if err := value.Encode(fields); err != nil {
+			return nil, err
+		}
+		if index >= 0 {
+			root.Content[index+1] = &value
+		} else {
+			root.Content = append(root.Content, stringNode(key), &value)
+		}
+	}
+
+	return encodeYAML(doc, asJSON)
+}
+
+// checkEntry checks that an edited document has fields as the entry for key,
+// or no entry when fields is nil
+func checkEntry(values map[string]any, key string, fields map[string]any) error {
+	entry, ok := values[key].(map[string]any)
+	if fields == nil {
+		if _, found := values[key]; found {
+			return fmt.Errorf("failed to remove %s, edit the file by hand", key)
+		}
+		return nil
+	}
+	if !ok || externalFromFields(key, entry) != externalFromFields(key, fields) {
+		return fmt.Errorf("failed to set %s, edit the file by hand", key)
+	}
+	return nil
+}
+
+// externalPath turns a target given as an absolute path, a path starting with
+// ~/ or a path relative to the home directory into the slash-separated path
+// relative to the destination directory chezmoi uses as key
+func externalPath(target string) (string, error) {
+	destDir, err := targetDir()
+	if err != nil {
+		return "", err
+	}
+
+	if rest, ok := strings.CutPrefix(target, "~/"); ok {
+		target = filepath.Join(destDir, rest)
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(destDir, target)
+	}
+
+	relPath, err := filepath.Rel(destDir, filepath.Clean(target))
+	if err != nil || relPath == "." || strings.HasPrefix(relPath, "..") {
+		return "", fmt.Errorf("external target must be inside %s: %s", destDir, target)
+	}
+
+	return filepath.ToSlash(relPath), nil
+}
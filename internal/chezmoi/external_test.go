@@ -0,0 +1,274 @@
+package chezmoi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSetTOMLEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		key     string
+		fields  map[string]any
+		want    string
+		wantErr string
+	}{
+		{
+			name: "add",
+			content: `# plugins
+[".oh-my-zsh"]
+    type = "archive" # upstream
+    url = "https://example.com/ohmyzsh.tar.gz"
+`,
+			key:    ".vim/pack/tpope",
+			fields: map[string]any{"type": "git-repo", "url": "https://github.com/tpope/vim-fugitive.git"},
+			want: `# plugins
+[".oh-my-zsh"]
+    type = "archive" # upstream
+    url = "https://example.com/ohmyzsh.tar.gz"
+
+['.vim/pack/tpope']
+type = 'git-repo'
+url = 'https://github.com/tpope/vim-fugitive.git'
+`,
+		},
+		{
+			name:    "add to empty file",
+			content: "",
+			key:     ".oh-my-zsh",
+			fields:  map[string]any{"type": "archive", "url": "https://example.com/a.tar.gz"},
+			want: `['.oh-my-zsh']
+type = 'archive'
+url = 'https://example.com/a.tar.gz'
+`,
+		},
+		{
+			name: "replace keeps the header and the other entries",
+			content: `# plugins
+[".oh-my-zsh"] # shell
+    type = "archive"
+    url = "https://example.com/old.tar.gz"
+
+# editor
+[".vim/pack/tpope"]
+    type = "git-repo"
+    url = "https://github.com/tpope/vim-fugitive.git"
+`,
+			key:    ".oh-my-zsh",
+			fields: map[string]any{"type": "archive", "url": "https://example.com/new.tar.gz", "exact": true},
+			want: `# plugins
+[".oh-my-zsh"] # shell
+    exact = true
+    type = 'archive'
+    url = 'https://example.com/new.tar.gz'
+
+# editor
+[".vim/pack/tpope"]
+    type = "git-repo"
+    url = "https://github.com/tpope/vim-fugitive.git"
+`,
+		},
+		{
+			name: "remove the first entry",
+			content: `# plugins
+
+# shell
+[".oh-my-zsh"]
+    type = "archive"
+    url = "https://example.com/a.tar.gz"
+
+[".oh-my-zsh".filter]
+    command = "true"
+
+[".vim/pack/tpope"] # editor
+    type = "git-repo"
+    url = "https://github.com/tpope/vim-fugitive.git"
+`,
+			key: ".oh-my-zsh",
+			want: `# plugins
+
+[".vim/pack/tpope"] # editor
+    type = "git-repo"
+    url = "https://github.com/tpope/vim-fugitive.git"
+`,
+		},
+		{
+			name: "remove an entry in the middle",
+			content: `[a]
+type = "archive"
+url = "https://example.com/a.tar.gz"
+
+# b is going away
+[b]
+type = "archive"
+url = "https://example.com/b.tar.gz"
+
+# c stays
+[c]
+type = "archive"
+url = "https://example.com/c.tar.gz"
+`,
+			key: "b",
+			want: `[a]
+type = "archive"
+url = "https://example.com/a.tar.gz"
+
+# c stays
+[c]
+type = "archive"
+url = "https://example.com/c.tar.gz"
+`,
+		},
+		{
+			name: "remove the last entry",
+			content: `[".oh-my-zsh"]
+    type = "archive"
+    url = "https://example.com/a.tar.gz"
+
+[".vim/pack/tpope"]
+    type = "git-repo"
+    url = "https://github.com/tpope/vim-fugitive.git"
+`,
+			key: ".vim/pack/tpope",
+			want: `[".oh-my-zsh"]
+    type = "archive"
+    url = "https://example.com/a.tar.gz"
+`,
+		},
+		{
+			name:    "entry defined inline",
+			content: "\".oh-my-zsh\" = { type = \"archive\", url = \"https://example.com/a.tar.gz\" }\n",
+			key:     ".oh-my-zsh",
+			wantErr: "not defined as a table",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := setTOMLEntry([]byte(test.content), test.key, test.fields)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("setTOMLEntry error = %v, want %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("setTOMLEntry: %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("setTOMLEntry =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSetYAMLEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		key     string
+		fields  map[string]any
+		asJSON  bool
+		want    string
+	}{
+		{
+			name: "add",
+			content: `# plugins
+.oh-my-zsh:
+  type: archive # upstream
+  url: https://example.com/a.tar.gz
+`,
+			key:    ".vim/pack/tpope",
+			fields: map[string]any{"type": "git-repo", "url": "https://github.com/tpope/vim-fugitive.git"},
+			want: `# plugins
+.oh-my-zsh:
+  type: archive # upstream
+  url: https://example.com/a.tar.gz
+.vim/pack/tpope:
+  type: git-repo
+  url: https://github.com/tpope/vim-fugitive.git
+`,
+		},
+		{
+			name: "replace",
+			content: `# plugins
+.oh-my-zsh:
+  type: archive
+  url: https://example.com/old.tar.gz
+# editor
+.vim/pack/tpope:
+  type: git-repo
+  url: https://github.com/tpope/vim-fugitive.git
+`,
+			key:    ".oh-my-zsh",
+			fields: map[string]any{"type": "archive", "url": "https://example.com/new.tar.gz", "stripComponents": 1},
+			want: `# plugins
+.oh-my-zsh:
+  stripComponents: 1
+  type: archive
+  url: https://example.com/new.tar.gz
+# editor
+.vim/pack/tpope:
+  type: git-repo
+  url: https://github.com/tpope/vim-fugitive.git
+`,
+		},
+		{
+			name: "remove",
+			content: `# plugins
+
+# shell
+.oh-my-zsh:
+  type: archive
+  url: https://example.com/a.tar.gz
+.vim/pack/tpope:
+  type: git-repo # editor
+  url: https://github.com/tpope/vim-fugitive.git
+`,
+			key: ".oh-my-zsh",
+			want: `# plugins
+
+.vim/pack/tpope:
+  type: git-repo # editor
+  url: https://github.com/tpope/vim-fugitive.git
+`,
+		},
+		{
+			name: "json keeps the order",
+			content: `{
+  ".vim/pack/tpope": {
+    "type": "git-repo",
+    "url": "https://github.com/tpope/vim-fugitive.git"
+  }
+}
+`,
+			key:    ".oh-my-zsh",
+			fields: map[string]any{"type": "archive", "url": "https://example.com/a.tar.gz"},
+			asJSON: true,
+			want: `{
+  ".vim/pack/tpope": {
+    "type": "git-repo",
+    "url": "https://github.com/tpope/vim-fugitive.git"
+  },
+  ".oh-my-zsh": {
+    "type": "archive",
+    "url": "https://example.com/a.tar.gz"
+  }
+}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := setYAMLEntry([]byte(test.content), test.key, test.fields, test.asJSON)
+			if err != nil {
+				t.Fatalf("setYAMLEntry: %v", err)
+			}
+			if string(got) != test.want {
+				t.Errorf("setYAMLEntry =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package chezmoi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bayou-brogrammer/mygo/internal/dots"
+	"github.com/bayou-brogrammer/mygo/internal/shell"
+)
+
+const (
+	// ImportAdd means the file is added to chezmoi
+	ImportAdd = "add"
+
+	// ImportManaged means chezmoi already manages the file
+	ImportManaged = "managed"
+
+	// ImportSkip means the file can't be imported automatically
+	ImportSkip = "skip"
+)
+
+// ImportOptions defines options for importing dotfiles into chezmoi
+type ImportOptions struct {
+	// Only report what would be imported
+	DryRun bool
+}
+
+// ImportEntry describes what happens to a single dotfile during an import
+type ImportEntry struct {
+	// Absolute path in the home directory
+	Target string
+
+	// Absolute path in the dotfiles directory
+	Source string
+
+	// Path chezmoi stores the file under, relative to its source directory
+	SourceName string
+
+	// One of ImportAdd, ImportManaged or ImportSkip
+	Action string
+
+	// Why the file is skipped, or a note about how it is imported
+	Note string
+}
+
+// ImportDots moves every file managed by dots into chezmoi
+func ImportDots() ([]ImportEntry, error) {
+	return ImportDotsWithOptions(ImportOptions{})
+}
+
+// ImportDotsWithOptions adds every file managed by dots to chezmoi, replaces
+// the dots links with plain files and verifies the result with chezmoi.
+// Files chezmoi already manages are left alone, so it can be run again after
+// an interrupted import.
+func ImportDotsWithOptions(options ImportOptions) ([]ImportEntry, error) {
+	// Check if chezmoi is installed
+	if !Installed() {
+		return nil, fmt.Errorf("chezmoi is not installed, please install it first")
+	}
+
+	files, err := dots.ManagedFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	managed, err := managedTargets()
+	if err != nil {
+		return nil, err
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	entries := make([]ImportEntry, 0, len(files))
+	for _, file := range files {
+		relPath, err := filepath.Rel(homeDir, file.Target)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get relative path: %w", err)
+		}
+
+		entry := ImportEntry{
+			Target:     file.Target,
+			Source:     file.Source,
+			SourceName: sourceName(relPath, file.Perm, file.Source),
+			Action:     ImportAdd,
+		}
+
+		switch {
+		case managed[file.Target] && !dots.IsLinked(file.Target):
+			entry.Action = ImportManaged
+		case file.Mode == dots.ModeEncrypted:
+			entry.Action = ImportSkip
+			entry.Note = "encrypted, add it with 'chezmoi add --encrypt' once chezmoi encryption is configured"
+		case file.Mode == dots.ModeTemplate:
+			entry.Note = "template, imported as rendered for this machine"
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if options.DryRun {
+		return entries, nil
+	}
+
+	var imported []string
+	for i, entry := range entries {
+		if entry.Action != ImportAdd {
+			continue
+		}
+
+		// Replace the link with a plain file, so chezmoi adds the content
+		if err := dots.Detach(files[i]); err != nil {
+			return entries[:i], err
+		}
+
+		result, err := execute("add", entry.Target)
+		if err != nil {
+			return entries[:i], fmt.Errorf("failed to add %s to chezmoi: %w", entry.Target, withStderr(result, err))
+		}
+
+		imported = append(imported, entry.Target)
+	}
+
+	if len(imported) == 0 {
+		return entries, nil
+	}
+
+	// Make sure chezmoi's source state now produces exactly these files
+	result, err := execute(append([]string{"verify"}, imported...)...)
+	if err != nil {
+		return entries, fmt.Errorf("chezmoi verify failed after import: %w", withStderr(result, err))
+	}
+
+	return entries, nil
+}
+
+// managedTargets returns the absolute paths of the files chezmoi manages
+func managedTargets() (map[string]bool, error) {
+	result, err := execute("managed", "--include=files", "--path-style=absolute")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chezmoi managed files: %w", withStderr(result, err))
+	}
+
+	managed := make(map[string]bool)
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			managed[filepath.Clean(line)] = true
+		}
+	}
+
+	return managed, nil
+}
+
+// sourceName predicts the chezmoi source path of a file relative to the home
+// directory from its mode and the modes of its parent directories in the
+// dotfiles repository
+func sourceName(relPath string, perm os.FileMode, source string) string {
+	parts := strings.Split(filepath.ToSlash(relPath), "/")
+	names := make([]string, len(parts))
+
+	// Parent directories, from the top down
+	sourceDir := filepath.Dir(source)
+	for i := len(parts) - 2; i >= 0; i-- {
+		prefix := ""
+		if info, err := os.Stat(sourceDir); err == nil && info.Mode().Perm()&0077 == 0 {
+			prefix = "private_"
+		}
+		names[i] = prefix + dotName(parts[i])
+		sourceDir = filepath.Dir(sourceDir)
+	}
+
+	// The file itself, with prefixes in the order chezmoi expects
+	prefix := ""
+	if perm&0077 == 0 {
+		prefix += "private_"
+	}
+	if perm&0222 == 0 {
+		prefix += "readonly_"
+	}
+	if perm&0111 != 0 {
+		prefix += "executable_"
+	}
+	names[len(parts)-1] = prefix + dotName(parts[len(parts)-1])
+
+	return strings.Join(names, "/")
+}
+
+// dotName replaces a leading dot with chezmoi's dot_ prefix
+func dotName(name string) string {
+	if rest, ok := strings.CutPrefix(name, "."); ok {
+		return "dot_" + rest
+	}
+	return name
+}
+
+// withStderr adds the stderr of a failed command to its error
+func withStderr(result *shell.Result, err error) error {
+	if result != nil {
+		if stderr := strings.TrimSpace(result.Stderr); stderr != "" {
+			return fmt.Errorf("%w: %s", err, stderr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,176 @@
+package chezmoi
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/shell"
+)
+
+// SourceInfo describes the chezmoi source directory
+type SourceInfo struct {
+	// Absolute path of the source directory
+	Dir string
+
+	// Whether Dir differs from chezmoi's default location, because of the milo
+	// config, sourceDir in chezmoi's config or a --source flag
+	Custom bool
+
+	// Source directory chezmoi uses on its own, set when chezmoi_dir in the
+	// milo config points somewhere else
+	Overridden string
+
+	// Whether Dir is a git repository
+	Git bool
+
+	// Whether the repository has uncommitted changes
+	Dirty bool
+
+	// Whether the current branch tracks a remote branch
+	Upstream bool
+
+	// Number of commits not pushed to the upstream branch
+	Unpushed int
+}
+
+// Warnings returns problems with the source directory worth telling the user about
+func (s SourceInfo) Warnings() []string {
+	var warnings []string
+	if s.Overridden != "" {
+		warnings = append(warnings, fmt.Sprintf("chezmoi_dir %s overrides the source directory %s from chezmoi's config", s.Dir, s.Overridden))
+	}
+	switch {
+	case !s.Git:
+		warnings = append(warnings, fmt.Sprintf("chezmoi source directory %s is not a git repository, changes are not backed up", s.Dir))
+	case !s.Upstream:
+		warnings = append(warnings, fmt.Sprintf("chezmoi source directory %s has no upstream branch, changes are not pushed anywhere", s.Dir))
+	case s.Unpushed > 0:
+		warnings = append(warnings, fmt.Sprintf("chezmoi source directory %s has %d unpushed commits", s.Dir, s.Unpushed))
+	}
+	if s.Git && s.Dirty {
+		warnings = append(warnings, fmt.Sprintf("chezmoi source directory %s has uncommitted changes", s.Dir))
+	}
+	return warnings
+}
+
+// DefaultSourceDir returns the source directory chezmoi uses without a
+// sourceDir setting or --source flag
+func DefaultSourceDir() (string, error) {
+	dataDir := os.Getenv("XDG_DATA_HOME")
+	if dataDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		dataDir = filepath.Join(homeDir, ".local", "share")
+	}
+
+	return filepath.Join(dataDir, "chezmoi"), nil
+}
+
+// Source resolves and inspects the chezmoi source directory
+func Source() (SourceInfo, error) {
+	// Check if chezmoi is installed
+	if !Installed() {
+		return SourceInfo{}, fmt.Errorf("chezmoi is not installed, please install it first")
+	}
+
+	dir, err := getChezmoiDir()
+	if err != nil {
+		return SourceInfo{}, err
+	}
+
+	info := SourceInfo{Dir: dir}
+	if defaultDir, err := DefaultSourceDir(); err == nil {
+		info.Custom = filepath.Clean(defaultDir) != dir
+	}
+
+	// Without the override chezmoi reports the directory from its own config
+	if cfg, err := config.GetConfig(); err == nil && cfg.ChezmoiDir != "" {
+		if own, err := ownSourceDir(); err == nil && own != dir {
+			info.Overridden = own
+		}
+	}
+
+	if _, err := shell.ExecuteInDir(dir, "git", "rev-parse", "--is-inside-work-tree"); err != nil {
+		return info, nil
+	}
+	info.Git = true
+
+	if result, err := shell.ExecuteInDir(dir, "git", "status", "--porcelain"); err == nil {
+		info.Dirty = strings.TrimSpace(result.Stdout) != ""
+	}
+
+	if result, err := shell.ExecuteInDir(dir, "git", "rev-list", "--count", "@{upstream}..HEAD"); err == nil {
+		info.Upstream = true
+		info.Unpushed, _ = strconv.Atoi(strings.TrimSpace(result.Stdout))
+	}
+
+	return info, nil
+}
+
+// getChezmoiDir resolves the chezmoi source directory to a clean absolute
+// path and checks that it exists
+func getChezmoiDir() (string, error) {
+	result, err := execute("source-path")
+	if err != nil {
+		return "", fmt.Errorf("failed to get chezmoi source path: %w", withStderr(result, err))
+	}
+
+	dir := strings.TrimSpace(result.Stdout)
+	if dir == "" {
+		return "", fmt.Errorf("chezmoi returned an empty source path")
+	}
+
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve chezmoi source path: %w", err)
+	}
+
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("chezmoi source directory not found: %s, run 'milo chezmoi init' first", dir)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read chezmoi source directory: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("chezmoi source path is not a directory: %s", dir)
+	}
+
+	return dir, nil
+}
+
+// ownSourceDir returns the source directory chezmoi resolves without the
+// chezmoi_dir override
+func ownSourceDir() (string, error) {
+	path, err := binary()
+	if err != nil {
+		return "", err
+	}
+
+	result, err := shell.Execute(path, "source-path")
+	if err != nil {
+		return "", fmt.Errorf("failed to get chezmoi source path: %w", withStderr(result, err))
+	}
+
+	return filepath.Abs(strings.TrimSpace(result.Stdout))
+}
+
+// execute runs chezmoi, passing --source only when the user set chezmoi_dir
+// in the milo config, so sourceDir in chezmoi's own config is honored otherwise
+func execute(args ...string) (*shell.Result, error) {
+	path, err := binary()
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg, err := config.GetConfig(); err == nil && cfg.ChezmoiDir != "" {
+		args = append([]string{"--source", cfg.ChezmoiDir}, args...)
+	}
+	return shell.Execute(path, args...)
+}
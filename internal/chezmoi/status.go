@@ -0,0 +1,240 @@
+package chezmoi
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// ChangeNone means the target doesn't differ
+	ChangeNone = "unchanged"
+
+	// ChangeAdded means the target is created
+	ChangeAdded = "added"
+
+	// ChangeDeleted means the target is removed
+	ChangeDeleted = "deleted"
+
+	// ChangeModified means the content or mode of the target changes
+	ChangeModified = "modified"
+
+	// ChangeRun means a script runs
+	ChangeRun = "run"
+)
+
+// statusChanges map the letters in chezmoi status output to changes
+var statusChanges = map[byte]string{
+	' ': ChangeNone,
+	'A': ChangeAdded,
+	'D': ChangeDeleted,
+	'M': ChangeModified,
+	'R': ChangeRun,
+}
+
+// StatusEntry describes the state of a single chezmoi target
+type StatusEntry struct {
+	// Absolute path in the destination directory
+	Target string
+
+	// Path relative to the destination directory
+	RelPath string
+
+	// Absolute path in the source directory, empty for unmanaged targets
+	Source string
+
+	// Change to the target since chezmoi last wrote it
+	Local string
+
+	// Change chezmoi apply would make to the target
+	Pending string
+}
+
+// Clean reports whether apply has nothing to do for the target
+func (e StatusEntry) Clean() bool {
+	return e.Pending == ChangeNone
+}
+
+// FileDiff is the change chezmoi apply would make to a single target
+type FileDiff struct {
+	// Absolute path in the destination directory
+	Target string
+
+	// Path relative to the destination directory
+	RelPath string
+
+	// Unified diff in git format
+	Patch string
+}
+
+// managedEntry is a target in the output of chezmoi managed --path-style all
+type managedEntry struct {
+	Absolute       string `json:"absolute"`
+	SourceAbsolute string `json:"sourceAbsolute"`
+	SourceRelative string `json:"sourceRelative"`
+}
+
+// Status returns the state of every target chezmoi manages, sorted by path
+func Status() ([]StatusEntry, error) {
+	// Check if chezmoi is installed
+	if !Installed() {
+		return nil, fmt.Errorf("chezmoi is not installed, please install it first")
+	}
+
+	destDir, err := targetDir()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := execute("managed", "--format", "json", "--path-style", "all")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list chezmoi managed files: %w", withStderr(result, err))
+	}
+
+	var managed map[string]managedEntry
+	if err := json.Unmarshal([]byte(result.Stdout), &managed); err != nil {
+		return nil, fmt.Errorf("failed to parse chezmoi managed files: %w", err)
+	}
+
+	entries := make(map[string]*StatusEntry, len(managed))
+	for relPath, m := range managed {
+		entries[relPath] = &StatusEntry{
+			Target:  m.Absolute,
+			RelPath: relPath,
+			Source:  m.SourceAbsolute,
+			Local:   ChangeNone,
+			Pending: ChangeNone,
+		}
+	}
+
+	result, err = execute("status")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chezmoi status: %w", withStderr(result, err))
+	}
+
+	changes, err := parseStatus(result.Stdout)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		entry, ok := entries[change.RelPath]
+		if !ok {
+			entry = &StatusEntry{
+				Target:  filepath.Join(destDir, filepath.FromSlash(change.RelPath)),
+				RelPath: change.RelPath,
+			}
+			entries[change.RelPath] = entry
+		}
+		entry.Local = change.Local
+		entry.Pending = change.Pending
+	}
+
+	sorted := make([]StatusEntry, 0, len(entries))
+	for _, entry := range entries {
+		sorted = append(sorted, *entry)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].RelPath < sorted[j].RelPath
+	})
+
+	return sorted, nil
+}
+
+// parseStatus parses the two-column output of chezmoi status. The first
+// column is the change since chezmoi last wrote the target, the second the
+// change apply would make.
+func parseStatus(output string) ([]StatusEntry, error) {
+	var entries []StatusEntry
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if len(line) < 4 {
+			return nil, fmt.Errorf("unexpected chezmoi status line: %q", line)
+		}
+
+		local, lok := statusChanges[line[0]]
+		pending, pok := statusChanges[line[1]]
+		if !lok || !pok {
+			return nil, fmt.Errorf("unexpected chezmoi status line: %q", line)
+		}
+
+		entries = append(entries, StatusEntry{
+			RelPath: filepath.ToSlash(line[3:]),
+			Local:   local,
+			Pending: pending,
+		})
+	}
+
+	return entries, nil
+}
+
+// Diff returns the changes chezmoi apply would make, limited to targets when
+// any are given
+func Diff(targets ...string) ([]FileDiff, error) {
+	// Check if chezmoi is installed
+	if !Installed() {
+		return nil, fmt.Errorf("chezmoi is not installed, please install it first")
+	}
+
+	destDir, err := targetDir()
+	if err != nil {
+		return nil, err
+	}
+
+	args := append([]string{"diff", "--no-pager", "--use-builtin-diff"}, targets...)
+	result, err := execute(args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff chezmoi targets: %w", withStderr(result, err))
+	}
+
+	return parseDiff(result.Stdout, destDir), nil
+}
+
+// parseDiff splits git format diff output into one diff per target
+func parseDiff(output, destDir string) []FileDiff {
+	var diffs []FileDiff
+	var patch strings.Builder
+
+	flush := func() {
+		if len(diffs) > 0 {
+			diffs[len(diffs)-1].Patch = patch.String()
+		}
+		patch.Reset()
+	}
+
+	for _, line := range strings.SplitAfter(output, "\n") {
+		if header, ok := strings.CutPrefix(line, "diff --git a/"); ok {
+			flush()
+
+			// The header is "a/<path> b/<path>" with the same path twice
+			relPath := strings.TrimSpace(header)
+			if i := strings.Index(relPath, " b/"); i >= 0 {
+				relPath = relPath[i+len(" b/"):]
+			}
+
+			diffs = append(diffs, FileDiff{
+				Target:  filepath.Join(destDir, filepath.FromSlash(relPath)),
+				RelPath: relPath,
+			})
+		}
+		patch.WriteString(line)
+	}
+	flush()
+
+	return diffs
+}
+
+// targetDir gets the chezmoi destination directory
+func targetDir() (string, error) {
+	result, err := execute("target-path")
+	if err != nil {
+		return "", fmt.Errorf("failed to get chezmoi target path: %w", withStderr(result, err))
+	}
+
+	return strings.TrimSpace(result.Stdout), nil
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 
 	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
 )
 
 // DefaultToolsFile defines the default list of tools
@@ -24,11 +25,43 @@ type Config struct {
 	DotfilesRepo string
 	DotfilesDir  string
 
-	// Chezmoi configuration
+	// Dotfiles layout, either "flat" or "packages"
+	DotfilesLayout string
+
+	// Enabled dotfiles packages keyed by hostname, with "default" as fallback
+	DotfilesPackages map[string][]string
+
+	// Default link mode for dotfiles: symlink, hardlink, copy or template
+	DotfilesLinkMode string
+
+	// Link modes for dotfiles matching a pattern, overriding the default
+	DotfilesLinkModes []LinkModeRule
+
+	// Variables available to dotfile templates as .Vars
+	DotfilesTemplateVars map[string]string
+
+	// Custom tags used to select dotfile variants such as ".zshrc##tag.work"
+	DotfilesTags []string
+
+	// Chezmoi source directory, empty to let chezmoi decide
 	ChezmoiDir string
 
-	// System configuration
-	Tools []string
+	// Local chezmoi binary or .tar.gz archive, as a path or URL, to install
+	// chezmoi from when no package manager can
+	ChezmoiBinary string
+
+	// SHA-256 of chezmoi_binary, required when it is a URL
+	ChezmoiSHA256 string
+
+	// Data for chezmoi templates, merged into chezmoi's config file
+	ChezmoiData map[string]string
+
+	// System configuration, written as tool names or full specs
+	Tools []ToolSpec
+
+	// Package manager to use instead of the detected one: apt, dnf, pacman,
+	// zypper, apk or brew
+	PackageManager string
 }
 
 // Repository represents a tracked GitHub repository
@@ -39,6 +72,12 @@ type Repository struct {
 	LastUpdated string
 }
 
+// LinkModeRule assigns a link mode to dotfiles matching a gitignore-style pattern
+type LinkModeRule struct {
+	Pattern string
+	Mode    string
+}
+
 // DefaultConfig returns a default configuration
 func DefaultConfig() *Config {
 	homeDir, err := os.UserHomeDir()
@@ -58,10 +97,15 @@ func DefaultConfig() *Config {
 		ConfigDir: filepath.Join(homeDir, ".config", "milo"),
 		// ReposDir:     filepath.Join(homeDir, "Projects"),
 		// TrackedRepos: make(map[string]Repository),
-		// DotfilesRepo: "",
-		// DotfilesDir:  filepath.Join(homeDir, ".dotfiles"),
+		DotfilesRepo: "",
+		DotfilesDir:  filepath.Join(homeDir, ".dotfiles"),
 		// ChezmoiDir:   filepath.Join(homeDir, ".local", "share", "chezmoi"),
-		Tools: DefaultTools,
+		DotfilesLayout:       "flat",
+		DotfilesPackages:     make(map[string][]string),
+		DotfilesLinkMode:     "symlink",
+		DotfilesTemplateVars: make(map[string]string),
+		ChezmoiData:          make(map[string]string),
+		Tools:                DefaultTools,
 	}
 }
 
@@ -87,9 +131,11 @@ func Init() (*Config, error) {
 
 	// Set defaults
 	// viper.SetDefault("repos_dir", cfg.ReposDir)
-	// viper.SetDefault("dotfiles_dir", cfg.DotfilesDir)
-	// viper.SetDefault("chezmoi_dir", cfg.ChezmoiDir)
-	viper.SetDefault("tools", cfg.Tools)
+	viper.SetDefault("dotfiles_dir", cfg.DotfilesDir)
+	viper.SetDefault("chezmoi_dir", cfg.ChezmoiDir)
+	viper.SetDefault("dotfiles_layout", cfg.DotfilesLayout)
+	viper.SetDefault("dotfiles_link_mode", cfg.DotfilesLinkMode)
+	viper.SetDefault("tools", toolsValue(cfg.Tools))
 
 	// Read configuration file
 	if err := viper.ReadInConfig(); err != nil {
@@ -105,10 +151,40 @@ func Init() (*Config, error) {
 
 	// Load configuration into struct
 	// cfg.ReposDir = viper.GetString("repos_dir")
-	// cfg.DotfilesRepo = viper.GetString("dotfiles_repo")
-	// cfg.DotfilesDir = viper.GetString("dotfiles_dir")
-	// cfg.ChezmoiDir = viper.GetString("chezmoi_dir")
-	cfg.Tools = viper.GetStringSlice("tools")
+	cfg.DotfilesRepo = viper.GetString("dotfiles_repo")
+	cfg.DotfilesDir = viper.GetString("dotfiles_dir")
+	cfg.ChezmoiDir = viper.GetString("chezmoi_dir")
+	cfg.DotfilesLayout = viper.GetString("dotfiles_layout")
+	if packages := viper.GetStringMapStringSlice("dotfiles_packages"); len(packages) > 0 {
+		cfg.DotfilesPackages = packages
+	}
+	cfg.DotfilesLinkMode = viper.GetString("dotfiles_link_mode")
+	if err := viper.UnmarshalKey("dotfiles_link_modes", &cfg.DotfilesLinkModes); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dotfiles link modes: %w", err)
+	}
+	vars, err := readStringMap(viper.ConfigFileUsed(), "dotfiles_template_vars")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dotfiles template variables: %w", err)
+	}
+	if len(vars) > 0 {
+		cfg.DotfilesTemplateVars = vars
+	}
+	cfg.DotfilesTags = viper.GetStringSlice("dotfiles_tags")
+	cfg.ChezmoiBinary = viper.GetString("chezmoi_binary")
+	cfg.ChezmoiSHA256 = viper.GetString("chezmoi_sha256")
+	data, err := readStringMap(viper.ConfigFileUsed(), "chezmoi_data")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chezmoi data: %w", err)
+	}
+	if len(data) > 0 {
+		cfg.ChezmoiData = data
+	}
+	tools, err := parseTools(viper.Get("tools"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tools: %w", err)
+	}
+	cfg.Tools = tools
+	cfg.PackageManager = viper.GetString("package_manager")
 
 	// Load tracked repositories
 	reposFile := filepath.Join(cfg.ConfigDir, "repos.yaml")
@@ -131,10 +207,20 @@ func Init() (*Config, error) {
 func (c *Config) Save() error {
 	// Save main configuration
 	// viper.Set("repos_dir", c.ReposDir)
-	// viper.Set("dotfiles_repo", c.DotfilesRepo)
-	// viper.Set("dotfiles_dir", c.DotfilesDir)
-	// viper.Set("chezmoi_dir", c.ChezmoiDir)
-	viper.Set("tools", c.Tools)
+	viper.Set("dotfiles_repo", c.DotfilesRepo)
+	viper.Set("dotfiles_dir", c.DotfilesDir)
+	viper.Set("chezmoi_dir", c.ChezmoiDir)
+	viper.Set("dotfiles_layout", c.DotfilesLayout)
+	viper.Set("dotfiles_packages", c.DotfilesPackages)
+	viper.Set("dotfiles_link_mode", c.DotfilesLinkMode)
+	viper.Set("dotfiles_link_modes", c.DotfilesLinkModes)
+	viper.Set("dotfiles_template_vars", c.DotfilesTemplateVars)
+	viper.Set("dotfiles_tags", c.DotfilesTags)
+	viper.Set("chezmoi_binary", c.ChezmoiBinary)
+	viper.Set("chezmoi_sha256", c.ChezmoiSHA256)
+	viper.Set("chezmoi_data", c.ChezmoiData)
+	viper.Set("tools", toolsValue(c.Tools))
+	viper.Set("package_manager", c.PackageManager)
 
 	if err := viper.WriteConfig(); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
@@ -160,10 +246,37 @@ func GetConfig() (*Config, error) {
 	return cfg, nil
 }
 
-// readDefaultTools reads the default tools from a YAML file
-func readDefaultTools(filename string) ([]string, error) {
-	var tools []string
+// readStringMap reads a map of template variables, such as chezmoi_data,
+// straight from the config file, because viper lowercases keys and template
+// variables are case sensitive
+func readStringMap(path, key string) (map[string]string, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
 
+	var file map[string]yaml.Node
+	if err := yaml.Unmarshal(content, &file); err != nil {
+		return nil, err
+	}
+
+	node, ok := file[key]
+	if !ok {
+		return nil, nil
+	}
+
+	var values map[string]string
+	if err := node.Decode(&values); err != nil {
+		return nil, fmt.Errorf("%s: %w", key, err)
+	}
+	return values, nil
+}
+
+// readDefaultTools reads the default tools from a YAML file
+func readDefaultTools(filename string) ([]ToolSpec, error) {
 	viper.SetConfigFile(filename)
 	viper.SetConfigType("yaml")
 
@@ -171,7 +284,8 @@ func readDefaultTools(filename string) ([]string, error) {
 		return nil, fmt.Errorf("failed to read default tools file: %w", err)
 	}
 
-	if err := viper.UnmarshalKey("tools", &tools); err != nil {
+	tools, err := parseTools(viper.Get("tools"))
+	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal default tools: %w", err)
 	}
 
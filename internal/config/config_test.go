@@ -0,0 +1,111 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// The default tools are read relative to the repository root, and the
+	// config file lives under HOME
+	home, err := os.MkdirTemp("", "milo-config-test-*")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	if err := os.Chdir(filepath.Join("..", "..")); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+func TestTemplateVarsKeepKeyCase(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(home, ".config", "milo")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	content := `dotfiles_template_vars:
+  GitEmail: me@example.com
+  editor: nvim
+chezmoi_data:
+  FullName: Me
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Init()
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	want := map[string]string{"GitEmail": "me@example.com", "editor": "nvim"}
+	for key, value := range want {
+		if got := cfg.DotfilesTemplateVars[key]; got != value {
+			t.Errorf("DotfilesTemplateVars[%q] = %q, want %q (loaded %v)", key, got, value, cfg.DotfilesTemplateVars)
+		}
+	}
+	if got := cfg.ChezmoiData["FullName"]; got != "Me" {
+		t.Errorf("ChezmoiData[FullName] = %q, want Me (loaded %v)", got, cfg.ChezmoiData)
+	}
+
+	// Saving must not rewrite the keys in lower case
+	if err := cfg.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	saved, err := readStringMap(path, "dotfiles_template_vars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved["GitEmail"] != "me@example.com" {
+		t.Errorf("saved dotfiles_template_vars = %v, want GitEmail kept", saved)
+	}
+}
+
+func TestReadStringMap(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := `dotfiles_dir: /tmp/dots
+dotfiles_template_vars:
+  MixedCase: value
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		path string
+		key  string
+		want map[string]string
+	}{
+		{"mixed case key", path, "dotfiles_template_vars", map[string]string{"MixedCase": "value"}},
+		{"missing key", path, "chezmoi_data", nil},
+		{"missing file", filepath.Join(t.TempDir(), "missing.yaml"), "chezmoi_data", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := readStringMap(test.path, test.key)
+			if err != nil {
+				t.Fatalf("readStringMap: %v", err)
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("readStringMap = %v, want %v", got, test.want)
+			}
+			for key, value := range test.want {
+				if got[key] != value {
+					t.Errorf("readStringMap[%q] = %q, want %q", key, got[key], value)
+				}
+			}
+		})
+	}
+}
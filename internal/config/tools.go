@@ -0,0 +1,265 @@
+package config
+
+import (
+	"fmt"
+	"runtime"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Install methods for tools
+const (
+	// MethodPackage installs the tool with the system package manager
+	MethodPackage = "package"
+
+	// MethodGo installs the tool with go install
+	MethodGo = "go"
+
+	// MethodCargo installs the tool with cargo install
+	MethodCargo = "cargo"
+
+	// MethodPipx installs the tool with pipx install
+	MethodPipx = "pipx"
+
+	// MethodArchive downloads the tool from a release archive
+	MethodArchive = "archive"
+
+	// MethodScript runs a custom install script
+	MethodScript = "script"
+
+	// MethodSystem means the tool comes with the base system and is never installed
+	MethodSystem = "system"
+)
+
+// Methods are the valid install methods
+var Methods = []string{MethodPackage, MethodGo, MethodCargo, MethodPipx, MethodArchive, MethodScript, MethodSystem}
+
+// ToolSpec describes a tool and how to install it. A tool given only by name
+// in the config takes the rest of its spec from milo's built-in tools.
+type ToolSpec struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+
+	// Package names keyed by package manager. Without packages the tool is
+	// installed under its own name by every package manager.
+	Packages map[string]string `yaml:"packages,omitempty"`
+
+	// Binaries that show the tool is installed, in order of preference. The
+	// tool name is used when empty.
+	Binaries []string `yaml:"binaries,omitempty"`
+
+	// Version the tool is pinned to. Older versions don't meet the
+	// requirements and newer ones are reported.
+	Version string `yaml:"version,omitempty"`
+
+	// Lowest acceptable version, such as "1.22"
+	MinVersion string `yaml:"min_version,omitempty"`
+
+	// Command that prints the version, such as "go version". The first binary
+	// with --version is used when empty.
+	VersionCommand string `yaml:"version_command,omitempty"`
+
+	// Regular expression whose first group, or whole match, is the version
+	VersionRegex string `yaml:"version_regex,omitempty"`
+
+	// Tags for selecting groups of tools, such as "dev" or "shell"
+	Tags []string `yaml:"tags,omitempty"`
+
+	// Platforms the tool is installed on, as GOOS or GOOS/GOARCH. Empty means all.
+	Platforms []string `yaml:"platforms,omitempty"`
+
+	// Whether a failure to install the tool is only a warning
+	Optional bool `yaml:"optional,omitempty"`
+
+	// One of Methods, MethodPackage when empty
+	Method string `yaml:"method,omitempty"`
+
+	// What the method installs: a module for go, a crate for cargo, a package
+	// for pipx, a URL template for archive or a shell command for script
+	Source string `yaml:"source,omitempty"`
+
+	// SHA-256 of the archive keyed by GOOS/GOARCH
+	Checksums map[string]string `yaml:"sha256,omitempty"`
+
+	// Install archives that have no sha256 pinned for this machine instead of
+	// refusing to
+	SkipChecksum bool `yaml:"skip_checksum,omitempty"`
+
+	// Other ways to install the tool, tried in order when the method can't be
+	// used, such as a user-level install when there's no root
+	Alternatives []InstallOption `yaml:"alternatives,omitempty"`
+}
+
+// InstallOption is an alternative way to install a tool
+type InstallOption struct {
+	Method       string            `yaml:"method"`
+	Source       string            `yaml:"source,omitempty"`
+	Checksums    map[string]string `yaml:"sha256,omitempty"`
+	SkipChecksum bool              `yaml:"skip_checksum,omitempty"`
+}
+
+// Candidates returns the spec once for its own method and once for each
+// alternative, in the order they should be tried
+func (t ToolSpec) Candidates() []ToolSpec {
+	candidates := []ToolSpec{t}
+	for _, option := range t.Alternatives {
+		candidate := t
+		candidate.Method = option.Method
+		candidate.Source = option.Source
+		candidate.Checksums = option.Checksums
+		candidate.SkipChecksum = option.SkipChecksum
+		candidate.Alternatives = nil
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+// InstallMethod returns the method used to install the tool
+func (t ToolSpec) InstallMethod() string {
+	if t.Method == "" {
+		return MethodPackage
+	}
+	return t.Method
+}
+
+// Package returns the package that provides the tool for a package manager
+func (t ToolSpec) Package(manager string) (string, bool) {
+	if t.InstallMethod() != MethodPackage {
+		return "", false
+	}
+	if t.Packages == nil {
+		return t.Name, true
+	}
+	pkg, ok := t.Packages[manager]
+	return pkg, ok
+}
+
+// Checksum returns the pinned SHA-256 of the archive for this machine
+func (t ToolSpec) Checksum() string {
+	return t.Checksums[runtime.GOOS+"/"+runtime.GOARCH]
+}
+
+// BinaryNames returns the binaries that show the tool is installed
+func (t ToolSpec) BinaryNames() []string {
+	if len(t.Binaries) == 0 {
+		return []string{t.Name}
+	}
+	return t.Binaries
+}
+
+// OnPlatform reports whether the tool is installed on this machine
+func (t ToolSpec) OnPlatform() bool {
+	return len(t.Platforms) == 0 ||
+		slices.Contains(t.Platforms, runtime.GOOS) ||
+		slices.Contains(t.Platforms, runtime.GOOS+"/"+runtime.GOARCH)
+}
+
+// HasTag reports whether the tool has any of the tags, or tags is empty
+func (t ToolSpec) HasTag(tags ...string) bool {
+	if len(tags) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(tags, func(tag string) bool {
+		return slices.Contains(t.Tags, tag)
+	})
+}
+
+// Validate checks that the spec can be installed
+func (t ToolSpec) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("tool name is required")
+	}
+	if !slices.Contains(Methods, t.InstallMethod()) {
+		return fmt.Errorf("invalid install method %q for %s", t.Method, t.Name)
+	}
+	switch t.InstallMethod() {
+	case MethodGo, MethodCargo, MethodPipx, MethodArchive, MethodScript:
+		if t.Source == "" {
+			return fmt.Errorf("%s install of %s needs a source", t.Method, t.Name)
+		}
+	}
+	for _, candidate := range t.Candidates()[1:] {
+		if candidate.Method == "" {
+			return fmt.Errorf("alternative install of %s needs a method", t.Name)
+		}
+		if err := candidate.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindTool returns the configured tool with a name
+func (c *Config) FindTool(name string) (ToolSpec, bool) {
+	for _, tool := range c.Tools {
+		if tool.Name == name {
+			return tool, true
+		}
+	}
+	return ToolSpec{}, false
+}
+
+// parseTools reads a tools list in which each entry is either a tool name or
+// a full spec
+func parseTools(value any) ([]ToolSpec, error) {
+	items, ok := value.([]any)
+	if !ok {
+		if value == nil {
+			return nil, nil
+		}
+		if names, ok := value.([]string); ok {
+			tools := make([]ToolSpec, len(names))
+			for i, name := range names {
+				tools[i] = ToolSpec{Name: name}
+			}
+			return tools, nil
+		}
+		return nil, fmt.Errorf("tools must be a list")
+	}
+
+	tools := make([]ToolSpec, 0, len(items))
+	for _, item := range items {
+		if name, ok := item.(string); ok {
+			tools = append(tools, ToolSpec{Name: name})
+			continue
+		}
+
+		// Decode maps through YAML so the field names match the config file
+		data, err := yaml.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		var tool ToolSpec
+		if err := yaml.Unmarshal(data, &tool); err != nil {
+			return nil, err
+		}
+		if err := tool.Validate(); err != nil {
+			return nil, err
+		}
+		tools = append(tools, tool)
+	}
+
+	return tools, nil
+}
+
+// toolsValue returns the tools as they are written to the config file, with
+// tools that only have a name written as plain strings
+func toolsValue(tools []ToolSpec) []any {
+	values := make([]any, len(tools))
+	for i, tool := range tools {
+		if tool.equal(ToolSpec{Name: tool.Name}) {
+			values[i] = tool.Name
+		} else {
+			values[i] = tool
+		}
+	}
+	return values
+}
+
+// equal reports whether two specs are the same
+func (t ToolSpec) equal(other ToolSpec) bool {
+	a, _ := yaml.Marshal(t)
+	b, _ := yaml.Marshal(other)
+	return string(a) == string(b)
+}
@@ -0,0 +1,503 @@
+package dots
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+)
+
+const (
+	// SymlinkSkip leaves symlinks inside added directories alone
+	SymlinkSkip = "skip"
+
+	// SymlinkFollow adds the file or directory a symlink points to
+	SymlinkFollow = "follow"
+
+	// SymlinkPreserve stores the symlink itself in the dotfiles repository
+	SymlinkPreserve = "preserve"
+)
+
+// AddOptions defines options for adding a file to the dotfiles repository
+type AddOptions struct {
+	// Package to add the file to when using the packages layout
+	Package string
+
+	// Store the file encrypted and keep the original in place instead of linking it
+	Encrypt bool
+
+	// How to handle symlinks: SymlinkSkip, SymlinkFollow or SymlinkPreserve
+	Symlinks string
+
+	// Show git commands and their error output
+	Verbose bool
+}
+
+// addEntry is a single file or symlink copied into the dotfiles repository
+type addEntry struct {
+	// Absolute path in the home directory
+	source string
+
+	// Path relative to the dotfiles directory
+	repoPath string
+
+	// Mode and owner of the source
+	info os.FileInfo
+
+	// Link target when a symlink is preserved
+	symlink string
+}
+
+// addPlan collects everything an Add copies into the dotfiles repository
+type addPlan struct {
+	entries []addEntry
+
+	// Directories that were added, relative to the dotfiles directory, with their modes
+	dirs map[string]os.FileInfo
+
+	// Symlinks that were skipped
+	skipped []string
+
+	// Resolved directories already visited when following symlinks
+	visited map[string]bool
+}
+
+// Add adds a file to the dotfiles repository
+func Add(filePath string) error {
+	return AddWithOptions(filePath, AddOptions{
+		Symlinks: SymlinkSkip,
+	})
+}
+
+// AddWithOptions adds a file or directory to the dotfiles repository with options
+func AddWithOptions(filePath string, options AddOptions) error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+
+	// Check if dotfiles directory exists
+	if _, err := os.Stat(cfg.DotfilesDir); os.IsNotExist(err) {
+		return fmt.Errorf("dotfiles directory not found: %s", cfg.DotfilesDir)
+	}
+
+	// Check if it's a git repository
+	gitDir := filepath.Join(cfg.DotfilesDir, ".git")
+	if _, err := os.Stat(gitDir); os.IsNotExist(err) {
+		return fmt.Errorf("not a git repository: %s", cfg.DotfilesDir)
+	}
+
+	// Check if file exists
+	if _, err := os.Lstat(filePath); os.IsNotExist(err) {
+		return fmt.Errorf("file not found: %s", filePath)
+	}
+
+	switch options.Symlinks {
+	case "":
+		options.Symlinks = SymlinkSkip
+	case SymlinkSkip, SymlinkFollow, SymlinkPreserve:
+	default:
+		return fmt.Errorf("unknown symlink policy: %s", options.Symlinks)
+	}
+
+	// Get absolute path of the file
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to get absolute path: %w", err)
+	}
+
+	// Get home directory
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	// Check if file is in home directory
+	if !isWithin(absPath, homeDir) || absPath == homeDir {
+		return fmt.Errorf("file must be in home directory: %s", absPath)
+	}
+
+	// Files that are already links into the repository are managed already
+	if dest, err := os.Readlink(absPath); err == nil && isWithin(dest, cfg.DotfilesDir) {
+		return fmt.Errorf("already managed by dotfiles: %s", absPath)
+	}
+
+	// Get relative path from home directory
+	relPath, err := filepath.Rel(homeDir, absPath)
+	if err != nil {
+		return fmt.Errorf("failed to get relative path: %w", err)
+	}
+
+	// In the packages layout the file lives below its package directory
+	repoPath := relPath
+	if cfg.DotfilesLayout == LayoutPackages {
+		if options.Package == "" {
+			return fmt.Errorf("a package is required when dotfiles_layout is %q", LayoutPackages)
+		}
+		repoPath = filepath.Join(options.Package, relPath)
+	}
+
+	// Refuse files the dotfiles walker would never link back
+	ignore, err := LoadIgnore(cfg.DotfilesDir, cfg.DotfilesLayout)
+	if err != nil {
+		return fmt.Errorf("failed to load ignore rules: %w", err)
+	}
+
+	if ignore.Ignored(repoPath, false) {
+		return fmt.Errorf("file is ignored by %s: %s", IgnoreFile, repoPath)
+	}
+
+	plan := &addPlan{
+		dirs:    make(map[string]os.FileInfo),
+		visited: make(map[string]bool),
+	}
+	if err := plan.collect(absPath, repoPath, cfg.DotfilesDir, ignore, options, true); err != nil {
+		return err
+	}
+
+	if len(plan.entries) == 0 {
+		return fmt.Errorf("nothing to add in %s", absPath)
+	}
+
+	// Fail before touching anything if the commit can't succeed
+	if err := checkGitIdentity(cfg.DotfilesDir); err != nil {
+		return err
+	}
+
+	// Every step is undone if a later one fails, leaving $HOME as it was
+	tx := &transaction{}
+	if err := plan.add(tx, cfg, options, fmt.Sprintf("Add %s", repoPath)); err != nil {
+		return tx.fail(err)
+	}
+	tx.commit()
+
+	for _, skipped := range plan.skipped {
+		fmt.Printf("Skipped symlink %s\n", skipped)
+	}
+
+	fmt.Printf("Added %s to dotfiles (%d files)\n", repoPath, len(plan.entries))
+
+	// Make sure the package the file went into is deployed on this machine
+	if options.Package != "" && !slices.Contains(enabledPackages(cfg, ""), options.Package) {
+		if err := Enable("", options.Package); err != nil {
+			return fmt.Errorf("failed to enable package: %w", err)
+		}
+		fmt.Printf("Enabled package %s\n", options.Package)
+	}
+
+	return nil
+}
+
+// collect adds path to the plan, descending into directories. Symlinks are
+// handled according to the policy in options.
+func (p *addPlan) collect(path, repoPath, dotfilesDir string, ignore *Ignore, options AddOptions, top bool) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	if !top && ignore.Match(repoPath, info.IsDir()) {
+		return nil
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		dest, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+
+		// Links milo created earlier are never added again
+		if resolved, err := filepath.EvalSymlinks(path); err == nil && isWithin(resolved, dotfilesDir) {
+			p.skipped = append(p.skipped, path)
+			return nil
+		}
+
+		switch options.Symlinks {
+		case SymlinkPreserve:
+			p.entries = append(p.entries, addEntry{source: path, repoPath: repoPath, info: info, symlink: dest})
+			return nil
+		case SymlinkFollow:
+			if info, err = os.Stat(path); err != nil {
+				return fmt.Errorf("failed to follow symlink %s: %w", path, err)
+			}
+		default:
+			p.skipped = append(p.skipped, path)
+			return nil
+		}
+	}
+
+	if !info.IsDir() {
+		if !info.Mode().IsRegular() {
+			p.skipped = append(p.skipped, path)
+			return nil
+		}
+		p.entries = append(p.entries, addEntry{source: path, repoPath: repoPath, info: info})
+		return nil
+	}
+
+	// Guard against symlink loops when following links
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	if p.visited[resolved] {
+		return nil
+	}
+	p.visited[resolved] = true
+
+	p.dirs[repoPath] = info
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		childPath := filepath.Join(path, entry.Name())
+		childRepoPath := filepath.Join(repoPath, entry.Name())
+		if err := p.collect(childPath, childRepoPath, dotfilesDir, ignore, options, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyFile copies a file from src to dst, keeping its mode and owner
+func copyFile(src, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	// Read source file
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	// Write to destination file
+	if err := os.WriteFile(dst, data, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	// WriteFile applies the umask, so set the mode explicitly
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	preserveOwner(info, dst)
+	return nil
+}
+
+// encryptFile encrypts src to the configured recipients and writes it to dst,
+// returning the checksum of the plaintext
+func encryptFile(cfg *config.Config, src, dst string) (string, error) {
+	recipients, err := loadRecipients(cfg)
+	if err != nil {
+		return "", err
+	}
+	if len(recipients) == 0 {
+		return "", ErrNoIdentity
+	}
+
+	plaintext, err := os.ReadFile(src)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := encrypt(plaintext, recipients)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(dst, ciphertext, EncryptedFileMode); err != nil {
+		return "", err
+	}
+
+	return checksum(plaintext), nil
+}
+
+// add copies the planned entries into the dotfiles repository, commits them
+// and replaces the originals with links, registering every step with tx
+func (p *addPlan) add(tx *transaction, cfg *config.Config, options AddOptions, message string) error {
+	perms, err := loadPermissions(cfg.DotfilesDir)
+	if err != nil {
+		return err
+	}
+
+	// Create added directories with their original modes
+	dirs := make([]string, 0, len(p.dirs))
+	for dir := range p.dirs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		path := filepath.Join(cfg.DotfilesDir, dir)
+		if err := tx.mkdirAll(path, 0755); err != nil {
+			return fmt.Errorf("failed to create directories: %w", err)
+		}
+		if err := tx.chmod(path, p.dirs[dir].Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to set directory mode: %w", err)
+		}
+		perms.record(dir, p.dirs[dir].Mode(), true)
+	}
+
+	sums := make(map[string]string)
+	gitPaths := []string{PermissionsFile}
+
+	for i := range p.entries {
+		entry := &p.entries[i]
+		if options.Encrypt && entry.symlink == "" {
+			entry.repoPath += EncryptedSuffix
+		}
+
+		targetPath := filepath.Join(cfg.DotfilesDir, entry.repoPath)
+
+		// Create parent directories if they don't exist
+		if err := tx.mkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+			return fmt.Errorf("failed to create directories: %w", err)
+		}
+
+		if err := tx.preserve(targetPath); err != nil {
+			return err
+		}
+
+		switch {
+		case entry.symlink != "":
+			// Store the symlink itself
+			os.Remove(targetPath)
+			if err := os.Symlink(entry.symlink, targetPath); err != nil {
+				return fmt.Errorf("failed to copy symlink: %w", err)
+			}
+		case options.Encrypt:
+			// Encrypt file into dotfiles directory
+			sum, err := encryptFile(cfg, entry.source, targetPath)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt file: %w", err)
+			}
+			sums[entry.source] = sum
+		default:
+			// Copy file to dotfiles directory
+			if err := copyFile(entry.source, targetPath); err != nil {
+				return fmt.Errorf("failed to copy file: %w", err)
+			}
+			perms.record(entry.repoPath, entry.info.Mode(), false)
+		}
+
+		if err := verifyCopy(cfg, *entry, targetPath, sums[entry.source]); err != nil {
+			return err
+		}
+
+		gitPaths = append(gitPaths, entry.repoPath)
+	}
+
+	permsPath := filepath.Join(cfg.DotfilesDir, PermissionsFile)
+	if err := tx.mkdirAll(filepath.Dir(permsPath), 0755); err != nil {
+		return fmt.Errorf("failed to create directories: %w", err)
+	}
+
+	if err := tx.preserve(permsPath); err != nil {
+		return err
+	}
+
+	if err := perms.save(cfg.DotfilesDir); err != nil {
+		return err
+	}
+
+	if err := tx.gitCommit(cfg.DotfilesDir, message, options.Verbose, gitPaths...); err != nil {
+		return err
+	}
+
+	state, err := loadState(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range p.entries {
+		targetPath := filepath.Join(cfg.DotfilesDir, entry.repoPath)
+		deployed := link{
+			Package: options.Package,
+			Source:  targetPath,
+			Target:  entry.source,
+		}
+
+		switch {
+		case entry.symlink != "":
+			// The original symlink already resolves the same way
+		case options.Encrypt:
+			// The original stays in place as the decrypted copy, readable only by the user
+			if err := tx.chmod(entry.source, 0600); err != nil {
+				return fmt.Errorf("failed to restrict permissions: %w", err)
+			}
+
+			// Recorded as deployed, so Apply doesn't treat it as edited
+			deployed.Mode = ModeEncrypted
+			state.record(deployed, sums[entry.source])
+		default:
+			// Replace the original with a symlink to the copy
+			if err := tx.swapSymlink(entry.source, targetPath); err != nil {
+				return fmt.Errorf("failed to create symlink: %w", err)
+			}
+
+			deployed.Mode = ModeSymlink
+			state.record(deployed, "")
+		}
+	}
+
+	if err := tx.preserve(state.path); err != nil {
+		return err
+	}
+
+	return state.save()
+}
+
+// verifyCopy checks that what was written to the dotfiles repository matches
+// the original before the original is replaced
+func verifyCopy(cfg *config.Config, entry addEntry, targetPath, plaintextSum string) error {
+	switch {
+	case entry.symlink != "":
+		dest, err := os.Readlink(targetPath)
+		if err != nil || dest != entry.symlink {
+			return fmt.Errorf("failed to verify copy of %s", entry.source)
+		}
+		return nil
+	case plaintextSum != "":
+		identity, err := loadIdentity(cfg)
+		if errors.Is(err, ErrNoIdentity) {
+			// Only recipients are configured on this machine, nothing to decrypt with
+			fmt.Printf("Warning: not verifying encrypted copy of %s, this machine has no encryption key\n", entry.source)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		ciphertext, err := os.ReadFile(targetPath)
+		if err != nil {
+			return err
+		}
+
+		plaintext, err := decrypt(ciphertext, identity)
+		if err != nil || checksum(plaintext) != plaintextSum {
+			return fmt.Errorf("failed to verify encrypted copy of %s", entry.source)
+		}
+		return nil
+	default:
+		want, err := fileChecksum(entry.source)
+		if err != nil {
+			return err
+		}
+
+		got, err := fileChecksum(targetPath)
+		if err != nil || got != want {
+			return fmt.Errorf("failed to verify copy of %s: checksums differ", entry.source)
+		}
+		return nil
+	}
+}
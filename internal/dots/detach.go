@@ -0,0 +1,186 @@
+package dots
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+)
+
+// ManagedFile is a single file Apply deploys into the home directory
+type ManagedFile struct {
+	// Absolute path in the home directory
+	Target string
+
+	// Absolute path in the dotfiles directory
+	Source string
+
+	// Link mode used to deploy the target
+	Mode string
+
+	// Mode bits of the source file
+	Perm os.FileMode
+}
+
+// ManagedFiles lists every file Apply deploys, with folded directories
+// expanded into the files they contain
+func ManagedFiles() ([]ManagedFile, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+
+	// Check if dotfiles directory exists
+	if _, err := os.Stat(cfg.DotfilesDir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("dotfiles directory not found: %s", cfg.DotfilesDir)
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	links, err := planLinks(cfg, homeDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dotfiles: %w", err)
+	}
+
+	var files []ManagedFile
+	for _, l := range links {
+		if !l.Dir {
+			info, err := os.Stat(l.Source)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, ManagedFile{Target: l.Target, Source: l.Source, Mode: l.Mode, Perm: info.Mode().Perm()})
+			continue
+		}
+
+		// Folded directories only ever contain plain files without variants
+		err := filepath.Walk(l.Source, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+
+			relPath, err := filepath.Rel(l.Source, path)
+			if err != nil {
+				return err
+			}
+
+			files = append(files, ManagedFile{
+				Target: filepath.Join(l.Target, relPath),
+				Source: path,
+				Mode:   ModeSymlink,
+				Perm:   info.Mode().Perm(),
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list dotfiles: %w", err)
+		}
+	}
+
+	return files, nil
+}
+
+// IsLinked reports whether target is a symlink into the dotfiles directory,
+// either itself or through a folded parent directory
+func IsLinked(target string) bool {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return false
+	}
+
+	resolved, err := filepath.EvalSymlinks(target)
+	return err == nil && resolved != target && isWithin(resolved, cfg.DotfilesDir)
+}
+
+// Detach replaces the target of a managed file with a plain file holding its
+// content and stops managing it. Folded parent directories are unfolded first
+// so only the target changes, and targets that were never deployed are
+// written from their source.
+func Detach(file ManagedFile) error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	state, err := loadState(cfg)
+	if err != nil {
+		return err
+	}
+
+	target := file.Target
+	if err := unfoldParents(target, cfg.DotfilesDir, homeDir); err != nil {
+		return err
+	}
+
+	info, err := os.Lstat(target)
+	switch {
+	case os.IsNotExist(err):
+		ctx := newDeployContext(cfg, homeDir)
+		content, err := ctx.content(link{Source: file.Source, Target: target, Mode: file.Mode})
+		if err != nil {
+			return fmt.Errorf("failed to detach %s: %w", target, err)
+		}
+
+		perm := file.Perm
+		if file.Mode == ModeEncrypted {
+			perm = 0600
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directories: %w", err)
+		}
+		if err := writeFileAtomic(target, content, perm); err != nil {
+			return fmt.Errorf("failed to detach %s: %w", target, err)
+		}
+	case err != nil:
+		return fmt.Errorf("failed to detach %s: %w", target, err)
+	case info.Mode()&os.ModeSymlink != 0:
+		dest, err := os.Readlink(target)
+		if err != nil || !isWithin(dest, cfg.DotfilesDir) {
+			return fmt.Errorf("not linked to dotfiles: %s", target)
+		}
+		if err := replaceWithCopy(target, dest); err != nil {
+			return fmt.Errorf("failed to detach %s: %w", target, err)
+		}
+	case file.Mode == ModeHardlink:
+		// Hard links share their content with the repository, so give the
+		// target its own copy
+		if err := replaceWithCopy(target, target); err != nil {
+			return fmt.Errorf("failed to detach %s: %w", target, err)
+		}
+	}
+
+	delete(state.Files, target)
+
+	// Directory links above target were just unfolded
+	for path := filepath.Dir(target); isWithin(path, homeDir) && path != homeDir; path = filepath.Dir(path) {
+		delete(state.Files, path)
+	}
+
+	return state.save()
+}
+
+// replaceWithCopy atomically replaces target with a copy of source, keeping
+// the mode of source
+func replaceWithCopy(target, source string) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(target, data, info.Mode().Perm())
+}
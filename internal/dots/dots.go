@@ -1,17 +1,28 @@
 package dots
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/bayou-brogrammer/mygo/internal/config"
 	"github.com/bayou-brogrammer/mygo/internal/shell"
 )
 
+// InitOptions defines options for initializing dotfiles
+type InitOptions struct {
+	// Show commands and their error output
+	Verbose bool
+}
+
 // Init initializes dotfiles from a repository or creates a new dotfiles repository
 func Init(repoURL string) error {
+	return InitWithOptions(repoURL, InitOptions{})
+}
+
+// InitWithOptions initializes dotfiles from a repository or creates a new dotfiles repository with options
+func InitWithOptions(repoURL string, options InitOptions) error {
 	cfg, err := config.GetConfig()
 	if err != nil {
 		return fmt.Errorf("failed to get config: %w", err)
@@ -29,7 +40,7 @@ func Init(repoURL string) error {
 			return fmt.Errorf("failed to clone dotfiles repository: %w", err)
 		}
 
-		shell.PrintResult(result, true)
+		shell.PrintResult(result, options.Verbose)
 
 		// Update configuration
 		cfg.DotfilesRepo = repoURL
@@ -43,14 +54,33 @@ func Init(repoURL string) error {
 			return fmt.Errorf("failed to initialize git repository: %w", err)
 		}
 
-		shell.PrintResult(result, true)
+		shell.PrintResult(result, options.Verbose)
 	}
 
 	return nil
 }
 
+// ApplyOptions defines options for applying dotfiles
+type ApplyOptions struct {
+	// Overwrite copied or rendered files even if they were edited after deployment
+	Force bool
+
+	// Only report what would change, without touching the home directory or running hooks
+	DryRun bool
+
+	// Show hook commands and their error output
+	Verbose bool
+}
+
 // Apply applies dotfiles configuration to the system
 func Apply() error {
+	return ApplyWithOptions(ApplyOptions{
+		Force: false,
+	})
+}
+
+// ApplyWithOptions applies dotfiles configuration to the system with options
+func ApplyWithOptions(options ApplyOptions) error {
 	cfg, err := config.GetConfig()
 	if err != nil {
 		return fmt.Errorf("failed to get config: %w", err)
@@ -61,101 +91,121 @@ func Apply() error {
 		return fmt.Errorf("dotfiles directory not found: %s", cfg.DotfilesDir)
 	}
 
-	// Apply dotfiles (this is a simple implementation, can be expanded)
-	// For now, we'll just create symlinks for all files in the dotfiles directory
-	err = filepath.Walk(cfg.DotfilesDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
 
-		// Skip the .git directory
-		if info.IsDir() && info.Name() == ".git" {
-			return filepath.SkipDir
-		}
+	links, err := planLinks(cfg, homeDir)
+	if err != nil {
+		return fmt.Errorf("failed to apply dotfiles: %w", err)
+	}
 
-		// Skip directories
-		if info.IsDir() {
-			return nil
-		}
+	state, err := loadState(cfg)
+	if err != nil {
+		return err
+	}
 
-		// Get relative path from dotfiles directory
-		relPath, err := filepath.Rel(cfg.DotfilesDir, path)
-		if err != nil {
-			return err
-		}
+	ctx := newDeployContext(cfg, homeDir)
 
-		// Skip files in the root directory that don't start with a dot
-		if !strings.HasPrefix(filepath.Base(relPath), ".") && filepath.Dir(relPath) == "." {
-			return nil
-		}
+	if options.DryRun {
+		return planApply(ctx, links, state, options)
+	}
 
-		// Create target path in home directory
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			return err
-		}
+	if err := runHooks(ctx, state, HookBefore, options); err != nil {
+		return errors.Join(err, state.save())
+	}
 
-		targetPath := filepath.Join(homeDir, relPath)
+	// A fresh clone creates files with the umask, so put recorded modes back first
+	perms, err := loadPermissions(cfg.DotfilesDir)
+	if err != nil {
+		return err
+	}
 
-		// Create parent directories if they don't exist
-		targetDir := filepath.Dir(targetPath)
-		if err := os.MkdirAll(targetDir, 0755); err != nil {
-			return err
-		}
+	if err := perms.restore(cfg.DotfilesDir); err != nil {
+		return err
+	}
 
-		// Remove existing file or symlink
-		if _, err := os.Lstat(targetPath); err == nil {
-			if err := os.Remove(targetPath); err != nil {
-				return err
-			}
+	// Clean up targets whose source was deleted or is no longer deployed here,
+	// before they can get in the way of the new links
+	if err := pruneOrphans(state, state.orphans(links), false); err != nil {
+		return fmt.Errorf("failed to apply dotfiles: %w", err)
+	}
+
+	// Deploy every planned link
+	for _, l := range links {
+		recorded := state.checksumFor(l.Target)
+		if !options.Force && recorded != "" && linkState(l, recorded, ctx) == StateModified {
+			fmt.Printf("Skipped %s: edited since it was deployed, use force to overwrite\n", l.Target)
+			continue
 		}
 
-		// Create symlink
-		if err := os.Symlink(path, targetPath); err != nil {
-			return err
+		sum, err := ctx.deploy(l)
+		if err != nil {
+			return fmt.Errorf("failed to apply dotfiles: %w", err)
 		}
 
-		fmt.Printf("Linked %s -> %s\n", targetPath, path)
-		return nil
-	})
+		state.record(l, sum)
 
-	if err != nil {
-		return fmt.Errorf("failed to apply dotfiles: %w", err)
+		switch l.Mode {
+		case ModeSymlink:
+			fmt.Printf("Linked %s -> %s\n", l.Target, l.Source)
+		default:
+			fmt.Printf("Deployed %s (%s) from %s\n", l.Target, l.Mode, l.Source)
+		}
 	}
 
-	return nil
+	// Directories created while unfolding get the modes they were added with
+	if err := perms.restoreDirs(cfg.DotfilesDir, homeDir, cfg.DotfilesLayout); err != nil {
+		return err
+	}
+
+	// The links are in place either way, so record them even if a hook fails
+	hookErr := runHooks(ctx, state, HookAfter, options)
+
+	return errors.Join(hookErr, state.save())
 }
 
-// Update updates dotfiles from the repository
-func Update() error {
-	cfg, err := config.GetConfig()
-	if err != nil {
-		return fmt.Errorf("failed to get config: %w", err)
+// planApply reports what Apply would do without changing anything
+func planApply(ctx *deployContext, links []link, state *State, options ApplyOptions) error {
+	if err := runHooks(ctx, state, HookBefore, options); err != nil {
+		return err
 	}
 
-	// Check if dotfiles directory exists
-	if _, err := os.Stat(cfg.DotfilesDir); os.IsNotExist(err) {
-		return fmt.Errorf("dotfiles directory not found: %s", cfg.DotfilesDir)
+	for _, orphan := range state.orphans(links) {
+		fmt.Printf("Would prune %s\n", orphan.Target)
 	}
 
-	// Check if it's a git repository
-	gitDir := filepath.Join(cfg.DotfilesDir, ".git")
-	if _, err := os.Stat(gitDir); os.IsNotExist(err) {
-		return fmt.Errorf("not a git repository: %s", cfg.DotfilesDir)
+	for _, l := range links {
+		current := linkState(l, state.checksumFor(l.Target), ctx)
+		switch {
+		case current == StateLinked:
+			continue
+		case current == StateModified && !options.Force:
+			fmt.Printf("Would skip %s: edited since it was deployed\n", l.Target)
+		case l.Mode == ModeSymlink:
+			fmt.Printf("Would link %s -> %s\n", l.Target, l.Source)
+		default:
+			fmt.Printf("Would deploy %s (%s) from %s\n", l.Target, l.Mode, l.Source)
+		}
 	}
 
-	// Pull latest changes
-	result, err := shell.ExecuteInDir(cfg.DotfilesDir, "git", "pull")
-	if err != nil {
-		return fmt.Errorf("failed to update dotfiles: %w", err)
-	}
+	return runHooks(ctx, state, HookAfter, options)
+}
 
-	shell.PrintResult(result, true)
-	return nil
+// UpdateOptions defines options for updating dotfiles
+type UpdateOptions struct {
+	// Show commands and their error output
+	Verbose bool
 }
 
-// Add adds a file to the dotfiles repository
-func Add(filePath string) error {
+// Update updates dotfiles from the repository
+func Update() error {
+	return UpdateWithOptions(UpdateOptions{})
+}
+
+// UpdateWithOptions updates dotfiles from the repository with options
+func UpdateWithOptions(options UpdateOptions) error {
 	cfg, err := config.GetConfig()
 	if err != nil {
 		return fmt.Errorf("failed to get config: %w", err)
@@ -172,85 +222,12 @@ func Add(filePath string) error {
 		return fmt.Errorf("not a git repository: %s", cfg.DotfilesDir)
 	}
 
-	// Check if file exists
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		return fmt.Errorf("file not found: %s", filePath)
-	}
-
-	// Get absolute path of the file
-	absPath, err := filepath.Abs(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to get absolute path: %w", err)
-	}
-
-	// Get home directory
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
-	}
-
-	// Check if file is in home directory
-	if !strings.HasPrefix(absPath, homeDir) {
-		return fmt.Errorf("file must be in home directory: %s", absPath)
-	}
-
-	// Get relative path from home directory
-	relPath, err := filepath.Rel(homeDir, absPath)
-	if err != nil {
-		return fmt.Errorf("failed to get relative path: %w", err)
-	}
-
-	// Create target path in dotfiles directory
-	targetPath := filepath.Join(cfg.DotfilesDir, relPath)
-
-	// Create parent directories if they don't exist
-	targetDir := filepath.Dir(targetPath)
-	if err := os.MkdirAll(targetDir, 0755); err != nil {
-		return fmt.Errorf("failed to create directories: %w", err)
-	}
-
-	// Copy file to dotfiles directory
-	if err := copyFile(absPath, targetPath); err != nil {
-		return fmt.Errorf("failed to copy file: %w", err)
-	}
-
-	// Add file to git
-	result, err := shell.ExecuteInDir(cfg.DotfilesDir, "git", "add", relPath)
-	if err != nil {
-		return fmt.Errorf("failed to add file to git: %w", err)
-	}
-
-	shell.PrintResult(result, true)
-
-	// Commit changes
-	result, err = shell.ExecuteInDir(cfg.DotfilesDir, "git", "commit", "-m", fmt.Sprintf("Add %s", relPath))
+	// Pull latest changes
+	result, err := shell.ExecuteInDir(cfg.DotfilesDir, "git", "pull")
 	if err != nil {
-		return fmt.Errorf("failed to commit changes: %w", err)
-	}
-
-	shell.PrintResult(result, true)
-
-	// Create symlink back to original location
-	if err := os.Remove(absPath); err != nil {
-		return fmt.Errorf("failed to remove original file: %w", err)
-	}
-
-	if err := os.Symlink(targetPath, absPath); err != nil {
-		return fmt.Errorf("failed to create symlink: %w", err)
+		return fmt.Errorf("failed to update dotfiles: %w", err)
 	}
 
-	fmt.Printf("Added %s to dotfiles\n", relPath)
+	shell.PrintResult(result, options.Verbose)
 	return nil
 }
-
-// copyFile copies a file from src to dst
-func copyFile(src, dst string) error {
-	// Read source file
-	data, err := os.ReadFile(src)
-	if err != nil {
-		return err
-	}
-
-	// Write to destination file
-	return os.WriteFile(dst, data, 0644)
-}
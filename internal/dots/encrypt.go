@@ -0,0 +1,574 @@
+package dots
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+)
+
+// EncryptedSuffix marks files in the dotfiles directory that are stored
+// encrypted; the suffix is dropped from the target name
+const EncryptedSuffix = ".encrypted"
+
+// EncryptedFileMode is the mode encrypted files are written with
+const EncryptedFileMode = 0600
+
+const (
+	// KeysDir is the directory under the config directory that holds encryption keys
+	KeysDir = "keys"
+
+	// IdentityFile holds this machine's private key
+	IdentityFile = "identity.key"
+
+	// RecipientsFile lists the public keys new files are encrypted to, one per line
+	RecipientsFile = "recipients.txt"
+
+	secretKeyPrefix = "milo-secret-key:"
+	publicKeyPrefix = "milo-public-key:"
+
+	encryptedHeader = "milo-encrypted/v1"
+	recipientStanza = "-> X25519 "
+	headerEnd       = "---"
+
+	fileKeySize = 32
+)
+
+var b64 = base64.RawStdEncoding
+
+// ErrNoIdentity is returned when no encryption key has been generated yet
+var ErrNoIdentity = errors.New("no encryption key found, run 'milo dots key generate' first")
+
+// keysDir returns the directory that holds the encryption keys
+func keysDir(cfg *config.Config) string {
+	return filepath.Join(cfg.ConfigDir, KeysDir)
+}
+
+// GenerateKey creates this machine's encryption key and adds its public key
+// to the recipients. It refuses to replace an existing key; use RotateKey for that.
+func GenerateKey() (string, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config: %w", err)
+	}
+
+	identityPath := filepath.Join(keysDir(cfg), IdentityFile)
+	if _, err := os.Stat(identityPath); err == nil {
+		return "", fmt.Errorf("encryption key already exists: %s", identityPath)
+	}
+
+	identity, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	if err := writeIdentity(cfg, identity); err != nil {
+		return "", err
+	}
+
+	recipients, err := loadRecipients(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	recipients = append(recipients, identity.PublicKey())
+	if err := writeRecipients(cfg, recipients); err != nil {
+		return "", err
+	}
+
+	return formatPublicKey(identity.PublicKey()), nil
+}
+
+// RotateKey replaces this machine's key with a new one and re-encrypts every
+// encrypted dotfile. The old key is kept next to the new one with a timestamp,
+// and if any step fails the old key, recipients and files are put back.
+func RotateKey() (string, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config: %w", err)
+	}
+
+	oldIdentity, err := loadIdentity(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	// Decrypt everything with the old key before anything is replaced
+	plaintexts, err := decryptAll(cfg, oldIdentity)
+	if err != nil {
+		return "", err
+	}
+
+	newIdentity, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	recipients, err := loadRecipients(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	// Swap the old public key for the new one, keeping other machines' keys
+	rotated := []*ecdh.PublicKey{newIdentity.PublicKey()}
+	for _, recipient := range recipients {
+		if !recipient.Equal(oldIdentity.PublicKey()) {
+			rotated = append(rotated, recipient)
+		}
+	}
+
+	// Encrypt everything to the new key before anything is replaced
+	ciphertexts, err := encryptAll(plaintexts, rotated)
+	if err != nil {
+		return "", err
+	}
+
+	// Keep a copy of the old key, and put the old key, recipients and files
+	// back if saving any of the new ones fails
+	tx := &transaction{}
+	identityPath := filepath.Join(keysDir(cfg), IdentityFile)
+	archived := fmt.Sprintf("%s.%s", identityPath, time.Now().Format("20060102150405"))
+	if err := copyFile(identityPath, archived); err != nil {
+		return "", fmt.Errorf("failed to archive old key: %w", err)
+	}
+	tx.onRollback(func() error {
+		return os.Remove(archived)
+	})
+
+	if err := tx.preserve(identityPath); err != nil {
+		return "", tx.fail(err)
+	}
+	if err := writeIdentity(cfg, newIdentity); err != nil {
+		return "", tx.fail(err)
+	}
+
+	if err := tx.preserve(filepath.Join(keysDir(cfg), RecipientsFile)); err != nil {
+		return "", tx.fail(err)
+	}
+	if err := writeRecipients(cfg, rotated); err != nil {
+		return "", tx.fail(err)
+	}
+
+	if err := writeEncrypted(tx, ciphertexts); err != nil {
+		return "", tx.fail(err)
+	}
+
+	tx.commit()
+	return formatPublicKey(newIdentity.PublicKey()), nil
+}
+
+// Reencrypt encrypts every encrypted dotfile again to the current recipients,
+// for example after a public key was added to the recipients file
+func Reencrypt() ([]string, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+
+	identity, err := loadIdentity(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintexts, err := decryptAll(cfg, identity)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients, err := loadRecipients(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertexts, err := encryptAll(plaintexts, recipients)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := &transaction{}
+	if err := writeEncrypted(tx, ciphertexts); err != nil {
+		return nil, tx.fail(err)
+	}
+	tx.commit()
+
+	paths := make([]string, 0, len(plaintexts))
+	for path := range plaintexts {
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
+// encryptedFiles lists every encrypted file in the dotfiles directory
+func encryptedFiles(dir string) ([]string, error) {
+	var paths []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		name, _ := splitVariant(info.Name())
+		if !info.IsDir() && strings.HasSuffix(name, EncryptedSuffix) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+
+	return paths, err
+}
+
+// decryptAll decrypts every encrypted dotfile, keyed by path
+func decryptAll(cfg *config.Config, identity *ecdh.PrivateKey) (map[string][]byte, error) {
+	paths, err := encryptedFiles(cfg.DotfilesDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find encrypted files: %w", err)
+	}
+
+	plaintexts := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		ciphertext, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		plaintext, err := decrypt(ciphertext, identity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s: %w", path, err)
+		}
+		plaintexts[path] = plaintext
+	}
+
+	return plaintexts, nil
+}
+
+// encryptAll encrypts every plaintext to recipients, keyed by path
+func encryptAll(plaintexts map[string][]byte, recipients []*ecdh.PublicKey) (map[string][]byte, error) {
+	ciphertexts := make(map[string][]byte, len(plaintexts))
+	for path, plaintext := range plaintexts {
+		ciphertext, err := encrypt(plaintext, recipients)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt %s: %w", path, err)
+		}
+		ciphertexts[path] = ciphertext
+	}
+
+	return ciphertexts, nil
+}
+
+// writeEncrypted writes every ciphertext to its path, restoring the previous
+// files on rollback
+func writeEncrypted(tx *transaction, ciphertexts map[string][]byte) error {
+	for path, ciphertext := range ciphertexts {
+		// Only files that were written need to be put back
+		var restore transaction
+		if err := restore.preserve(path); err != nil {
+			return err
+		}
+
+		if err := writeFileAtomic(path, ciphertext, EncryptedFileMode); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		tx.onRollback(restore.rollback)
+	}
+
+	return nil
+}
+
+// loadIdentity reads this machine's private key
+func loadIdentity(cfg *config.Config) (*ecdh.PrivateKey, error) {
+	data, err := os.ReadFile(filepath.Join(keysDir(cfg), IdentityFile))
+	if os.IsNotExist(err) {
+		return nil, ErrNoIdentity
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read encryption key: %w", err)
+	}
+
+	var encoded string
+	for _, line := range strings.Split(string(data), "\n") {
+		if key, ok := strings.CutPrefix(strings.TrimSpace(line), secretKeyPrefix); ok {
+			encoded = key
+			break
+		}
+	}
+
+	if encoded == "" {
+		return nil, fmt.Errorf("invalid encryption key file")
+	}
+
+	raw, err := b64.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+
+	return ecdh.X25519().NewPrivateKey(raw)
+}
+
+// writeIdentity stores the private key readable only by the current user
+func writeIdentity(cfg *config.Config, identity *ecdh.PrivateKey) error {
+	if err := os.MkdirAll(keysDir(cfg), 0700); err != nil {
+		return fmt.Errorf("failed to create keys directory: %w", err)
+	}
+
+	data := fmt.Sprintf("# public key: %s\n%s%s\n",
+		formatPublicKey(identity.PublicKey()), secretKeyPrefix, b64.EncodeToString(identity.Bytes()))
+
+	if err := writeFileAtomic(filepath.Join(keysDir(cfg), IdentityFile), []byte(data), 0600); err != nil {
+		return fmt.Errorf("failed to write encryption key: %w", err)
+	}
+
+	return nil
+}
+
+// loadRecipients reads the public keys new files are encrypted to
+func loadRecipients(cfg *config.Config) ([]*ecdh.PublicKey, error) {
+	file, err := os.Open(filepath.Join(keysDir(cfg), RecipientsFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recipients: %w", err)
+	}
+	defer file.Close()
+
+	var recipients []*ecdh.PublicKey
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		recipient, err := ParsePublicKey(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", line, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, scanner.Err()
+}
+
+// writeRecipients stores the public keys new files are encrypted to
+func writeRecipients(cfg *config.Config, recipients []*ecdh.PublicKey) error {
+	var buf bytes.Buffer
+	for _, recipient := range recipients {
+		fmt.Fprintln(&buf, formatPublicKey(recipient))
+	}
+
+	if err := writeFileAtomic(filepath.Join(keysDir(cfg), RecipientsFile), buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write recipients: %w", err)
+	}
+
+	return nil
+}
+
+// ParsePublicKey parses a public key as printed by GenerateKey
+func ParsePublicKey(s string) (*ecdh.PublicKey, error) {
+	encoded, ok := strings.CutPrefix(s, publicKeyPrefix)
+	if !ok {
+		return nil, fmt.Errorf("missing %q prefix", publicKeyPrefix)
+	}
+
+	raw, err := b64.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return ecdh.X25519().NewPublicKey(raw)
+}
+
+// formatPublicKey encodes a public key for the recipients file
+func formatPublicKey(key *ecdh.PublicKey) string {
+	return publicKeyPrefix + b64.EncodeToString(key.Bytes())
+}
+
+// encrypt seals plaintext with a random file key, which is wrapped once for
+// every recipient in the header, in the spirit of age's X25519 recipients:
+//
+//	milo-encrypted/v1
+//	-> X25519 <ephemeral public key>
+//	<wrapped file key>
+//	---
+//	<nonce><AES-256-GCM ciphertext, authenticated together with the header>
+func encrypt(plaintext []byte, recipients []*ecdh.PublicKey) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no recipients, run 'milo dots key generate' first")
+	}
+
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+
+	var header bytes.Buffer
+	header.WriteString(encryptedHeader + "\n")
+
+	for _, recipient := range recipients {
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		wrapKey, err := wrappingKey(ephemeral, recipient, ephemeral.PublicKey(), recipient)
+		if err != nil {
+			return nil, err
+		}
+
+		wrapped, err := seal(wrapKey, make([]byte, 12), fileKey, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		header.WriteString(recipientStanza + b64.EncodeToString(ephemeral.PublicKey().Bytes()) + "\n")
+		header.WriteString(b64.EncodeToString(wrapped) + "\n")
+	}
+	header.WriteString(headerEnd + "\n")
+
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	payload, err := seal(fileKey, nonce, plaintext, header.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	out := append(header.Bytes(), nonce...)
+	return append(out, payload...), nil
+}
+
+// decrypt opens data produced by encrypt with identity
+func decrypt(data []byte, identity *ecdh.PrivateKey) ([]byte, error) {
+	offset := 0
+	readLine := func() (string, error) {
+		end := bytes.IndexByte(data[offset:], '\n')
+		if end < 0 {
+			return "", fmt.Errorf("truncated header")
+		}
+		line := string(data[offset : offset+end])
+		offset += end + 1
+		return line, nil
+	}
+
+	if line, err := readLine(); err != nil || line != encryptedHeader {
+		return nil, fmt.Errorf("not a milo encrypted file")
+	}
+
+	var fileKey []byte
+	for {
+		line, err := readLine()
+		if err != nil {
+			return nil, err
+		}
+		if line == headerEnd {
+			break
+		}
+
+		encodedKey, ok := strings.CutPrefix(line, recipientStanza)
+		if !ok {
+			return nil, fmt.Errorf("invalid header line %q", line)
+		}
+
+		wrappedLine, err := readLine()
+		if err != nil {
+			return nil, err
+		}
+
+		// Stop trying once a stanza unwrapped, but keep reading the header
+		if fileKey != nil {
+			continue
+		}
+
+		ephemeralBytes, err := b64.DecodeString(encodedKey)
+		if err != nil {
+			return nil, err
+		}
+		ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		wrapped, err := b64.DecodeString(wrappedLine)
+		if err != nil {
+			return nil, err
+		}
+
+		wrapKey, err := wrappingKey(identity, ephemeral, ephemeral, identity.PublicKey())
+		if err != nil {
+			return nil, err
+		}
+
+		// A stanza for another recipient fails to open, which is expected
+		if key, err := open(wrapKey, make([]byte, 12), wrapped, nil); err == nil {
+			fileKey = key
+		}
+	}
+
+	if fileKey == nil {
+		return nil, fmt.Errorf("file is not encrypted to this machine's key")
+	}
+
+	header, rest := data[:offset], data[offset:]
+	if len(rest) < 12 {
+		return nil, fmt.Errorf("truncated payload")
+	}
+
+	return open(fileKey, rest[:12], rest[12:], header)
+}
+
+// wrappingKey derives the key that wraps the file key for one recipient from
+// the X25519 exchange between private and peer, bound to both public keys
+func wrappingKey(private *ecdh.PrivateKey, peer, ephemeral, recipient *ecdh.PublicKey) ([]byte, error) {
+	shared, err := private.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := append(append([]byte{}, ephemeral.Bytes()...), recipient.Bytes()...)
+	return hkdf.Key(sha256.New, shared, salt, encryptedHeader+" X25519", fileKeySize)
+}
+
+// seal encrypts with AES-256-GCM
+func seal(key, nonce, plaintext, additional []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nil, nonce, plaintext, additional), nil
+}
+
+// open decrypts with AES-256-GCM
+func open(key, nonce, ciphertext, additional []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, nonce, ciphertext, additional)
+}
+
+// newGCM creates an AES-GCM cipher for key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
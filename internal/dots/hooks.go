@@ -0,0 +1,183 @@
+package dots
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bayou-brogrammer/mygo/internal/platform"
+	"github.com/bayou-brogrammer/mygo/internal/shell"
+)
+
+// HooksDir holds the hook scripts, relative to the dotfiles directory. Scripts
+// in its "before" and "after" directories run around Apply in name order.
+var HooksDir = filepath.Join(MetadataDir, "hooks")
+
+const (
+	// HookBefore scripts run before any dotfile is deployed
+	HookBefore = "before"
+
+	// HookAfter scripts run after every dotfile was deployed
+	HookAfter = "after"
+)
+
+const (
+	// HookAlways scripts run on every apply
+	HookAlways = "always"
+
+	// HookOnce scripts run once; a script runs again only if its content changes
+	// to something that never ran before
+	HookOnce = "once"
+
+	// HookOnChange scripts run whenever their content changed since they last ran
+	HookOnChange = "onchange"
+)
+
+// hookPrefixes map script name prefixes to how often the script runs
+var hookPrefixes = map[string]string{
+	"run_once_":     HookOnce,
+	"run_onchange_": HookOnChange,
+}
+
+// HookRun records a hook that ran successfully
+type HookRun struct {
+	Path     string
+	Kind     string
+	Checksum string
+
+	// When the hook last ran, in RFC 3339 format
+	RanAt string
+}
+
+// hook is a script found in HooksDir
+type hook struct {
+	// Path relative to the dotfiles directory
+	RelPath  string
+	Path     string
+	Kind     string
+	Checksum string
+}
+
+// key identifies the recorded run of the hook. Run-once hooks are tracked by
+// content, so renaming them doesn't run them again.
+func (h hook) key() string {
+	if h.Kind == HookOnce {
+		return HookOnce + ":" + h.Checksum
+	}
+	return h.RelPath
+}
+
+// due reports whether the hook has to run given what ran before
+func (h hook) due(state *State) bool {
+	switch h.Kind {
+	case HookOnce:
+		_, ran := state.Hooks[h.key()]
+		return !ran
+	case HookOnChange:
+		return state.Hooks[h.key()].Checksum != h.Checksum
+	default:
+		return true
+	}
+}
+
+// loadHooks returns the hook scripts for a phase in name order
+func loadHooks(dotfilesDir, phase string) ([]hook, error) {
+	dir := filepath.Join(dotfilesDir, HooksDir, phase)
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read hooks: %w", err)
+	}
+
+	var hooks []hook
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		sum, err := fileChecksum(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read hook %s: %w", name, err)
+		}
+
+		kind := HookAlways
+		for prefix, prefixKind := range hookPrefixes {
+			if strings.HasPrefix(name, prefix) {
+				kind = prefixKind
+			}
+		}
+
+		hooks = append(hooks, hook{
+			RelPath:  filepath.ToSlash(filepath.Join(HooksDir, phase, name)),
+			Path:     path,
+			Kind:     kind,
+			Checksum: sum,
+		})
+	}
+
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].RelPath < hooks[j].RelPath
+	})
+
+	return hooks, nil
+}
+
+// runHooks runs the due hooks of a phase and records them in the state. It
+// stops at the first hook that fails.
+func runHooks(ctx *deployContext, state *State, phase string, options ApplyOptions) error {
+	hooks, err := loadHooks(ctx.cfg.DotfilesDir, phase)
+	if err != nil {
+		return err
+	}
+
+	facts := platform.Detect()
+	env := []string{
+		"MILO_DOTFILES_DIR=" + ctx.cfg.DotfilesDir,
+		"MILO_HOME=" + ctx.homeDir,
+		"MILO_HOOK_PHASE=" + phase,
+		"MILO_OS=" + facts.OS,
+		"MILO_HOSTNAME=" + facts.Hostname,
+	}
+
+	for _, h := range hooks {
+		if !h.due(state) {
+			continue
+		}
+
+		if options.DryRun {
+			fmt.Printf("Would run %s hook %s\n", phase, h.RelPath)
+			continue
+		}
+
+		fmt.Printf("Running %s hook %s\n", phase, h.RelPath)
+
+		// Scripts without the executable bit run through sh
+		command, args := h.Path, []string{}
+		if info, err := os.Stat(h.Path); err == nil && info.Mode().Perm()&0111 == 0 {
+			command, args = "sh", []string{h.Path}
+		}
+
+		result, err := shell.ExecuteWithEnv(ctx.cfg.DotfilesDir, env, command, args...)
+		shell.PrintResult(result, options.Verbose)
+		if err != nil {
+			return fmt.Errorf("hook %s failed: %w", h.RelPath, withStderr(result, err))
+		}
+
+		state.Hooks[h.key()] = HookRun{
+			Path:     h.RelPath,
+			Kind:     h.Kind,
+			Checksum: h.Checksum,
+			RanAt:    time.Now().UTC().Format(time.RFC3339),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,289 @@
+package dots
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bayou-brogrammer/mygo/internal/platform"
+)
+
+// IgnoreFile is the name of the file in the dotfiles directory that lists
+// paths the dotfiles walker should skip, using gitignore-style patterns
+const IgnoreFile = ".miloignore"
+
+// defaultIgnorePatterns are evaluated before the patterns from IgnoreFile,
+// so any of them can be re-included with a "!" pattern
+var defaultIgnorePatterns = []string{
+	".git/",
+	IgnoreFile,
+	MetadataDir + "/",
+	".gitignore",
+	".gitmodules",
+	".github/",
+	"README*",
+	"LICENSE*",
+	".DS_Store",
+	"*.swp",
+	"*.swo",
+	"*~",
+}
+
+// flatIgnorePatterns are added to the defaults in the flat layout, where
+// top-level entries without a leading dot, such as install.sh or a Makefile,
+// belong to the repository rather than to $HOME. The packages layout keeps
+// its packages there instead.
+var flatIgnorePatterns = []string{
+	"/[^.]*",
+}
+
+// ignoreRule is a single parsed ignore pattern
+type ignoreRule struct {
+	// Pattern split on "/"; "**" matches any number of segments
+	segments []string
+
+	// Re-include paths matched by earlier rules
+	negate bool
+
+	// Only match directories
+	dirOnly bool
+
+	// Match against the full relative path instead of any path component
+	anchored bool
+}
+
+// Ignore holds the ignore rules for a dotfiles directory
+type Ignore struct {
+	rules []ignoreRule
+}
+
+// LoadIgnore reads the ignore rules for the given dotfiles directory and
+// layout. A missing IgnoreFile is not an error; only the default rules apply
+// then.
+//
+// Sections restrict the patterns that follow them to a host, OS or distro:
+//
+//	[host:buildbox]
+//	.config/i3/
+//	[os:darwin]
+//	.config/systemd/
+//	[*]
+//	scripts/
+func LoadIgnore(dir, layout string) (*Ignore, error) {
+	ignore := &Ignore{}
+	for _, pattern := range defaultIgnorePatterns {
+		ignore.add(pattern)
+	}
+	if layout != LayoutPackages {
+		for _, pattern := range flatIgnorePatterns {
+			ignore.add(pattern)
+		}
+	}
+
+	file, err := os.Open(filepath.Join(dir, IgnoreFile))
+	if os.IsNotExist(err) {
+		return ignore, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", IgnoreFile, err)
+	}
+	defer file.Close()
+
+	facts := platform.Detect()
+	active := true
+
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip blank lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Section headers switch the active condition
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			active, err = sectionMatches(line[1:len(line)-1], facts)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %w", IgnoreFile, lineNum, err)
+			}
+			continue
+		}
+
+		if active {
+			ignore.add(line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", IgnoreFile, err)
+	}
+
+	return ignore, nil
+}
+
+// sectionMatches reports whether a section header applies to this machine
+func sectionMatches(section string, facts platform.Facts) (bool, error) {
+	if section == "*" {
+		return true, nil
+	}
+
+	kind, value, ok := strings.Cut(section, ":")
+	if !ok {
+		return false, fmt.Errorf("invalid section [%s], expected [host:name], [os:name], [distro:name] or [*]", section)
+	}
+
+	switch strings.TrimSpace(kind) {
+	case "host":
+		return strings.EqualFold(strings.TrimSpace(value), facts.Hostname), nil
+	case "os":
+		return strings.EqualFold(strings.TrimSpace(value), facts.OS), nil
+	case "distro":
+		return facts.Distro.Is(strings.TrimSpace(value)), nil
+	default:
+		return false, fmt.Errorf("unknown section type %q", kind)
+	}
+}
+
+// add parses a pattern and appends it to the rules
+func (ig *Ignore) add(pattern string) {
+	if rule, ok := parsePattern(pattern); ok {
+		ig.rules = append(ig.rules, rule)
+	}
+}
+
+// parsePattern parses a single gitignore-style pattern
+func parsePattern(pattern string) (ignoreRule, bool) {
+	rule := ignoreRule{}
+
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	}
+
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+
+	// A slash anywhere but the end anchors the pattern to the root
+	if strings.Contains(pattern, "/") {
+		rule.anchored = true
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+
+	if pattern == "" {
+		return rule, false
+	}
+
+	rule.segments = strings.Split(pattern, "/")
+	return rule, true
+}
+
+// Match reports whether relPath itself is ignored, without looking at its
+// parent directories. The last matching rule wins, as in gitignore.
+func (ig *Ignore) Match(relPath string, isDir bool) bool {
+	relPath = filepath.ToSlash(relPath)
+	ignored := false
+
+	for _, rule := range ig.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.matches(relPath) {
+			ignored = !rule.negate
+		}
+	}
+
+	return ignored
+}
+
+// Ignored reports whether relPath or any of its parent directories is ignored
+func (ig *Ignore) Ignored(relPath string, isDir bool) bool {
+	parts := strings.Split(filepath.ToSlash(filepath.Clean(relPath)), "/")
+
+	for i := 1; i < len(parts); i++ {
+		if ig.Match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+
+	return ig.Match(relPath, isDir)
+}
+
+// matches checks a slash-separated relative path against the rule
+func (r ignoreRule) matches(relPath string) bool {
+	if r.anchored {
+		return matchSegments(r.segments, strings.Split(relPath, "/"))
+	}
+
+	// Unanchored patterns match the last path component
+	matched, _ := path.Match(r.segments[0], path.Base(relPath))
+	return matched
+}
+
+// matchSegments matches pattern segments against path segments with support for "**"
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Try every possible number of segments for "**"
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(parts) == 0 {
+			return false
+		}
+
+		if matched, _ := path.Match(pattern[0], parts[0]); !matched {
+			return false
+		}
+
+		pattern = pattern[1:]
+		parts = parts[1:]
+	}
+
+	return len(parts) == 0
+}
+
+// walkDotfiles calls fn for every file in dir that is not ignored
+func walkDotfiles(dir string, ignore *Ignore, fn func(path, relPath string, info os.FileInfo) error) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// Get relative path from dotfiles directory
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		if relPath == "." {
+			return nil
+		}
+
+		if ignore.Match(relPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Skip directories
+		if info.IsDir() {
+			return nil
+		}
+
+		return fn(path, relPath, info)
+	})
+}
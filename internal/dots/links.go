@@ -0,0 +1,239 @@
+package dots
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/platform"
+)
+
+// link is a single source to target mapping that Apply creates
+type link struct {
+	// Package the link belongs to, empty in the flat layout
+	Package string
+
+	// Path relative to the home directory
+	RelPath string
+
+	// Absolute path in the dotfiles directory
+	Source string
+
+	// Absolute path in the home directory
+	Target string
+
+	// Dir is set when a whole directory is folded into one symlink
+	Dir bool
+
+	// Link mode used to deploy the target
+	Mode string
+
+	// Conditions of the selected variant, empty for the default file
+	Variant string
+
+	// Why the variant was selected
+	Reason string
+}
+
+// planLinks computes every link Apply should create for the configured layout
+func planLinks(cfg *config.Config, homeDir string) ([]link, error) {
+	ignore, err := LoadIgnore(cfg.DotfilesDir, cfg.DotfilesLayout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ignore rules: %w", err)
+	}
+
+	modes, err := newLinkModes(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var links []link
+	switch cfg.DotfilesLayout {
+	case "", LayoutFlat:
+		links, err = planFlatLinks(cfg.DotfilesDir, homeDir, ignore)
+	case LayoutPackages:
+		links, err = planPackageLinks(cfg, homeDir, ignore, modes)
+	default:
+		return nil, fmt.Errorf("unknown dotfiles layout: %s", cfg.DotfilesLayout)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	links, err = resolveVariants(links, homeDir, variantFacts{
+		facts: platform.Detect(),
+		tags:  cfg.DotfilesTags,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range links {
+		modes.applyMode(&links[i], homeDir)
+	}
+
+	return links, nil
+}
+
+// planFlatLinks maps the whole dotfiles directory onto the home directory
+func planFlatLinks(dir, homeDir string, ignore *Ignore) ([]link, error) {
+	var links []link
+	err := walkDotfiles(dir, ignore, func(path, relPath string, info os.FileInfo) error {
+		links = append(links, link{
+			RelPath: relPath,
+			Source:  path,
+			Target:  filepath.Join(homeDir, relPath),
+		})
+		return nil
+	})
+
+	return links, err
+}
+
+// createLink replaces whatever is at the link target with a symlink to its source
+func createLink(l link, dotfilesDir, homeDir string) error {
+	if err := prepareTarget(l.Target, dotfilesDir, homeDir); err != nil {
+		return err
+	}
+
+	// Create symlink
+	return os.Symlink(l.Source, l.Target)
+}
+
+// prepareTarget makes room for a new file at target, creating its parent
+// directories and removing whatever is there now
+func prepareTarget(target, dotfilesDir, homeDir string) error {
+	// Parent directories may still be folded into another package
+	if err := unfoldParents(target, dotfilesDir, homeDir); err != nil {
+		return err
+	}
+
+	// Create parent directories if they don't exist
+	targetDir := filepath.Dir(target)
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return err
+	}
+
+	// Remove existing file or symlink
+	if _, err := os.Lstat(target); err == nil {
+		if err := os.Remove(target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// linkState inspects the target of a link and reports whether it is
+// deployed; recorded is the checksum stored for copied, rendered and decrypted files
+func linkState(l link, recorded string, ctx *deployContext) LinkState {
+	info, err := os.Lstat(l.Target)
+	if os.IsNotExist(err) {
+		return StateMissing
+	}
+
+	switch l.Mode {
+	case ModeHardlink:
+		sourceInfo, err := os.Stat(l.Source)
+		if err != nil || info.Mode()&os.ModeSymlink != 0 || !os.SameFile(info, sourceInfo) {
+			return StateConflict
+		}
+		return StateLinked
+	case ModeCopy, ModeTemplate, ModeEncrypted:
+		if recorded == "" || info.Mode()&os.ModeSymlink != 0 {
+			return StateConflict
+		}
+
+		// The deployed copy was edited since milo wrote it
+		if current, err := fileChecksum(l.Target); err != nil || current != recorded {
+			return StateModified
+		}
+
+		// The source changed since it was last deployed
+		content, err := ctx.content(l)
+		if err != nil || checksum(content) != recorded {
+			return StateOutdated
+		}
+		return StateLinked
+	default:
+		dest, err := os.Readlink(l.Target)
+		if err != nil || dest != l.Source {
+			return StateConflict
+		}
+		return StateLinked
+	}
+}
+
+// unfoldParents turns folded directory symlinks above target back into
+// real directories, so target can be linked next to another package's files
+func unfoldParents(target, dotfilesDir, homeDir string) error {
+	rel, err := filepath.Rel(homeDir, filepath.Dir(target))
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return nil
+	}
+
+	current := homeDir
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+
+		dest, err := os.Readlink(current)
+		if err != nil {
+			// Not a symlink, or not there yet
+			continue
+		}
+
+		if !isWithin(dest, dotfilesDir) {
+			continue
+		}
+
+		if err := unfold(current, dest); err != nil {
+			return fmt.Errorf("failed to unfold %s: %w", current, err)
+		}
+	}
+
+	return nil
+}
+
+// unfold replaces a directory symlink with a real directory whose entries
+// link to the entries of the directory it pointed at
+func unfold(target, source string) error {
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(target); err != nil {
+		return err
+	}
+
+	// The directory keeps the mode of the one it pointed at
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Mkdir(target, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(target, info.Mode().Perm()); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := os.Symlink(filepath.Join(source, entry.Name()), filepath.Join(target, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isWithin reports whether path is inside dir
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
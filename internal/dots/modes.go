@@ -0,0 +1,308 @@
+package dots
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/platform"
+)
+
+const (
+	// ModeSymlink links the target to the file in the dotfiles directory
+	ModeSymlink = "symlink"
+
+	// ModeHardlink hard links the target to the file in the dotfiles directory
+	ModeHardlink = "hardlink"
+
+	// ModeCopy writes a copy of the file to the target
+	ModeCopy = "copy"
+
+	// ModeTemplate renders the file with text/template and writes the result to the target
+	ModeTemplate = "template"
+
+	// ModeEncrypted decrypts the file and writes it to the target readable only by the user.
+	// It is implied by EncryptedSuffix and can't be configured.
+	ModeEncrypted = "encrypted"
+)
+
+// TemplateSuffix marks files that are rendered as templates by default;
+// the suffix is dropped from the target name
+const TemplateSuffix = ".tmpl"
+
+// TemplateData is the data available to dotfile templates
+type TemplateData struct {
+	Hostname string
+	OS       string
+	Arch     string
+	User     string
+	Home     string
+	Distro   string
+	Tags     []string
+
+	// User-defined variables from dotfiles_template_vars
+	Vars map[string]string
+}
+
+// modeRule is a link mode that applies to paths matching a pattern
+type modeRule struct {
+	rule ignoreRule
+	mode string
+}
+
+// linkModes resolves the link mode for each dotfile
+type linkModes struct {
+	defaultMode string
+	rules       []modeRule
+}
+
+// newLinkModes builds the link mode rules from the configuration
+func newLinkModes(cfg *config.Config) (*linkModes, error) {
+	modes := &linkModes{defaultMode: cfg.DotfilesLinkMode}
+	if modes.defaultMode == "" {
+		modes.defaultMode = ModeSymlink
+	}
+
+	if !validMode(modes.defaultMode) {
+		return nil, fmt.Errorf("unknown link mode: %s", modes.defaultMode)
+	}
+
+	for _, rule := range cfg.DotfilesLinkModes {
+		if !validMode(rule.Mode) {
+			return nil, fmt.Errorf("unknown link mode %q for pattern %s", rule.Mode, rule.Pattern)
+		}
+
+		parsed, ok := parsePattern(rule.Pattern)
+		if !ok {
+			return nil, fmt.Errorf("invalid link mode pattern: %q", rule.Pattern)
+		}
+
+		modes.rules = append(modes.rules, modeRule{rule: parsed, mode: rule.Mode})
+	}
+
+	return modes, nil
+}
+
+// validMode reports whether mode is a known link mode
+func validMode(mode string) bool {
+	switch mode {
+	case ModeSymlink, ModeHardlink, ModeCopy, ModeTemplate:
+		return true
+	default:
+		return false
+	}
+}
+
+// modeFor returns the link mode for a path relative to the home directory.
+// The last matching rule wins; files ending in TemplateSuffix default to
+// templates and files ending in EncryptedSuffix are always decrypted.
+func (m *linkModes) modeFor(relPath string) string {
+	if strings.HasSuffix(relPath, EncryptedSuffix) {
+		return ModeEncrypted
+	}
+
+	mode := m.defaultMode
+	if strings.HasSuffix(relPath, TemplateSuffix) {
+		mode = ModeTemplate
+	}
+
+	relPath = filepath.ToSlash(relPath)
+	for _, rule := range m.rules {
+		if rule.rule.matches(relPath) {
+			mode = rule.mode
+		}
+	}
+
+	return mode
+}
+
+// applyMode sets the link mode on a planned file link and drops the
+// template or encryption suffix from its target
+func (m *linkModes) applyMode(l *link, homeDir string) {
+	if l.Dir {
+		l.Mode = ModeSymlink
+		return
+	}
+
+	l.Mode = m.modeFor(l.RelPath)
+	switch {
+	case l.Mode == ModeEncrypted:
+		l.RelPath = strings.TrimSuffix(l.RelPath, EncryptedSuffix)
+	case l.Mode == ModeTemplate && strings.HasSuffix(l.RelPath, TemplateSuffix):
+		l.RelPath = strings.TrimSuffix(l.RelPath, TemplateSuffix)
+	default:
+		return
+	}
+	l.Target = filepath.Join(homeDir, l.RelPath)
+}
+
+// newTemplateData collects host facts and user variables for templates
+func newTemplateData(cfg *config.Config) TemplateData {
+	facts := platform.Detect()
+
+	return TemplateData{
+		Hostname: facts.Hostname,
+		OS:       facts.OS,
+		Arch:     facts.Arch,
+		User:     facts.User,
+		Home:     facts.Home,
+		Distro:   facts.Distro.ID,
+		Tags:     cfg.DotfilesTags,
+		Vars:     cfg.DotfilesTemplateVars,
+	}
+}
+
+// renderTemplate renders the template at path with data
+func renderTemplate(path string, data TemplateData) ([]byte, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(filepath.Base(path)).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", path, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", path, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// deployContext carries what deploying links needs beyond the links themselves
+type deployContext struct {
+	cfg     *config.Config
+	homeDir string
+	data    TemplateData
+
+	// Loaded on first use, so machines without a key can still deploy plain files
+	identity *ecdh.PrivateKey
+}
+
+// newDeployContext prepares deployment of links into homeDir
+func newDeployContext(cfg *config.Config, homeDir string) *deployContext {
+	return &deployContext{
+		cfg:     cfg,
+		homeDir: homeDir,
+		data:    newTemplateData(cfg),
+	}
+}
+
+// content returns the bytes a copied, rendered or decrypted link deploys
+func (c *deployContext) content(l link) ([]byte, error) {
+	switch l.Mode {
+	case ModeTemplate:
+		return renderTemplate(l.Source, c.data)
+	case ModeEncrypted:
+		if c.identity == nil {
+			identity, err := loadIdentity(c.cfg)
+			if err != nil {
+				return nil, err
+			}
+			c.identity = identity
+		}
+
+		ciphertext, err := os.ReadFile(l.Source)
+		if err != nil {
+			return nil, err
+		}
+
+		plaintext, err := decrypt(ciphertext, c.identity)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s: %w", l.Source, err)
+		}
+		return plaintext, nil
+	default:
+		return os.ReadFile(l.Source)
+	}
+}
+
+// deploy creates the target of a planned link according to its mode.
+// For every mode but symlinks it returns the checksum of what was written.
+func (c *deployContext) deploy(l link) (string, error) {
+	switch l.Mode {
+	case ModeHardlink:
+		if err := prepareTarget(l.Target, c.cfg.DotfilesDir, c.homeDir); err != nil {
+			return "", err
+		}
+		if err := os.Link(l.Source, l.Target); err != nil {
+			return "", err
+		}
+		return fileChecksum(l.Target)
+	case ModeCopy, ModeTemplate, ModeEncrypted:
+		content, err := c.content(l)
+		if err != nil {
+			return "", err
+		}
+
+		// Decrypted secrets are only ever readable by the user
+		perm := os.FileMode(0600)
+		if l.Mode != ModeEncrypted {
+			info, err := os.Stat(l.Source)
+			if err != nil {
+				return "", err
+			}
+			perm = info.Mode().Perm()
+		}
+
+		if err := prepareTarget(l.Target, c.cfg.DotfilesDir, c.homeDir); err != nil {
+			return "", err
+		}
+
+		if err := writeFileAtomic(l.Target, content, perm); err != nil {
+			return "", err
+		}
+		return checksum(content), nil
+	default:
+		return "", createLink(l, c.cfg.DotfilesDir, c.homeDir)
+	}
+}
+
+// writeFileAtomic writes data next to path and renames it into place
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".milo-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// checksum returns the hex encoded SHA-256 of data
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// fileChecksum returns the hex encoded SHA-256 of the file at path
+func fileChecksum(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return checksum(data), nil
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package dots
+
+import (
+	"os"
+	"syscall"
+)
+
+// preserveOwner gives path the same owner as info, which matters when milo
+// runs with sudo. Failing to change the owner is not an error.
+func preserveOwner(info os.FileInfo, path string) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+
+	if int(stat.Uid) == os.Geteuid() && int(stat.Gid) == os.Getegid() {
+		return
+	}
+
+	_ = os.Lchown(path, int(stat.Uid), int(stat.Gid))
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package dots
+
+import "os"
+
+// preserveOwner is a no-op on Windows, where files have no Unix owner
+func preserveOwner(info os.FileInfo, path string) {}
@@ -0,0 +1,405 @@
+package dots
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/platform"
+)
+
+const (
+	// LayoutFlat maps the whole dotfiles directory onto the home directory
+	LayoutFlat = "flat"
+
+	// LayoutPackages treats each top-level directory as a stow-style package
+	LayoutPackages = "packages"
+
+	// DefaultPackagesHost is the config key used for hosts without their own package list
+	DefaultPackagesHost = "default"
+)
+
+// Package describes a top-level directory in a packages layout
+type Package struct {
+	Name    string
+	Path    string
+	Enabled bool
+}
+
+// ListPackages returns every package in the dotfiles directory and whether
+// it is enabled on the current host
+func ListPackages() ([]Package, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+
+	names, err := packageNames(cfg.DotfilesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	enabled := enabledPackages(cfg, "")
+
+	packages := make([]Package, 0, len(names))
+	for _, name := range names {
+		packages = append(packages, Package{
+			Name:    name,
+			Path:    filepath.Join(cfg.DotfilesDir, name),
+			Enabled: slices.Contains(enabled, name),
+		})
+	}
+
+	return packages, nil
+}
+
+// Enable enables packages for a host; an empty host means the current one
+func Enable(host string, names ...string) error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+
+	available, err := packageNames(cfg.DotfilesDir)
+	if err != nil {
+		return err
+	}
+
+	host = packagesHost(host)
+	enabled := enabledPackages(cfg, host)
+
+	for _, name := range names {
+		if !slices.Contains(available, name) {
+			return fmt.Errorf("package not found in %s: %s", cfg.DotfilesDir, name)
+		}
+		if !slices.Contains(enabled, name) {
+			enabled = append(enabled, name)
+		}
+	}
+
+	sort.Strings(enabled)
+	cfg.DotfilesPackages[host] = enabled
+
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	if cfg.DotfilesLayout != LayoutPackages {
+		fmt.Printf("Note: dotfiles_layout is %q, set it to %q for packages to take effect\n", cfg.DotfilesLayout, LayoutPackages)
+	}
+
+	return nil
+}
+
+// Disable disables packages for a host and removes their links from the
+// home directory; an empty host means the current one
+func Disable(host string, names ...string) error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+
+	host = packagesHost(host)
+	enabled := enabledPackages(cfg, host)
+
+	for _, name := range names {
+		if !slices.Contains(enabled, name) {
+			return fmt.Errorf("package is not enabled: %s", name)
+		}
+		enabled = slices.DeleteFunc(enabled, func(p string) bool { return p == name })
+	}
+
+	cfg.DotfilesPackages[host] = enabled
+
+	if err := cfg.Save(); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	// Only touch the home directory when the change affects this machine
+	if !affectsCurrentHost(cfg, host) {
+		return nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	state, err := loadState(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		for _, file := range state.sorted() {
+			if file.Package != name {
+				continue
+			}
+			if err := forget(state, file, false, "Unlinked"); err != nil {
+				return fmt.Errorf("failed to unlink package %s: %w", name, err)
+			}
+		}
+
+		// Links deployed before the package was recorded in the state
+		if err := unlinkPackage(filepath.Join(cfg.DotfilesDir, name), homeDir); err != nil {
+			return fmt.Errorf("failed to unlink package %s: %w", name, err)
+		}
+	}
+
+	return state.save()
+}
+
+// packageNames lists the top-level directories of the dotfiles directory
+// that are not ignored
+func packageNames(dir string) ([]string, error) {
+	ignore, err := LoadIgnore(dir, LayoutPackages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load ignore rules: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dotfiles directory: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && !ignore.Match(entry.Name(), true) {
+			names = append(names, entry.Name())
+		}
+	}
+
+	return names, nil
+}
+
+// packagesHost returns the config key for host, defaulting to this machine
+func packagesHost(host string) string {
+	if host == "" {
+		host = platform.Detect().Hostname
+	}
+
+	// Viper lowercases map keys when reading the config back
+	return strings.ToLower(host)
+}
+
+// affectsCurrentHost reports whether the package list stored under host is
+// the one this machine uses
+func affectsCurrentHost(cfg *config.Config, host string) bool {
+	current := packagesHost("")
+	if host == current {
+		return true
+	}
+
+	_, hasOwn := cfg.DotfilesPackages[current]
+	return host == DefaultPackagesHost && !hasOwn
+}
+
+// enabledPackages returns a copy of the packages enabled for host, falling
+// back to the default list when the host has none of its own
+func enabledPackages(cfg *config.Config, host string) []string {
+	if cfg.DotfilesPackages == nil {
+		cfg.DotfilesPackages = make(map[string][]string)
+	}
+
+	if packages, ok := cfg.DotfilesPackages[packagesHost(host)]; ok {
+		return slices.Clone(packages)
+	}
+
+	return slices.Clone(cfg.DotfilesPackages[DefaultPackagesHost])
+}
+
+// packageFiles holds the files of one package relative to the package root
+type packageFiles struct {
+	name  string
+	root  string
+	files []string
+
+	// Directories that contain ignored or non-symlinked entries and therefore can't be folded
+	unfoldable map[string]bool
+}
+
+// planPackageLinks maps every enabled package onto the home directory,
+// folding directories that are owned by a single package into one symlink
+func planPackageLinks(cfg *config.Config, homeDir string, ignore *Ignore, modes *linkModes) ([]link, error) {
+	var packages []packageFiles
+	for _, name := range enabledPackages(cfg, "") {
+		pkg, err := readPackage(cfg.DotfilesDir, name, ignore, modes)
+		if err != nil {
+			return nil, err
+		}
+		packages = append(packages, pkg)
+	}
+
+	// Count which packages contribute to each target directory
+	owners := make(map[string]map[string]bool)
+	for _, pkg := range packages {
+		for _, file := range pkg.files {
+			for dir := filepath.Dir(file); dir != "."; dir = filepath.Dir(dir) {
+				if owners[dir] == nil {
+					owners[dir] = make(map[string]bool)
+				}
+				owners[dir][pkg.name] = true
+			}
+		}
+	}
+
+	var links []link
+	for _, pkg := range packages {
+		folded := make(map[string]bool)
+
+		for _, file := range pkg.files {
+			dir := foldableDir(pkg, file, owners, homeDir)
+			if dir == "" {
+				links = append(links, link{
+					Package: pkg.name,
+					RelPath: file,
+					Source:  filepath.Join(pkg.root, file),
+					Target:  filepath.Join(homeDir, file),
+				})
+				continue
+			}
+
+			if folded[dir] {
+				continue
+			}
+			folded[dir] = true
+
+			links = append(links, link{
+				Package: pkg.name,
+				RelPath: dir,
+				Source:  filepath.Join(pkg.root, dir),
+				Target:  filepath.Join(homeDir, dir),
+				Dir:     true,
+			})
+		}
+	}
+
+	return links, nil
+}
+
+// readPackage collects the files of a package that are not ignored
+func readPackage(dotfilesDir, name string, ignore *Ignore, modes *linkModes) (packageFiles, error) {
+	pkg := packageFiles{
+		name:       name,
+		root:       filepath.Join(dotfilesDir, name),
+		unfoldable: make(map[string]bool),
+	}
+
+	if _, err := os.Stat(pkg.root); err != nil {
+		return pkg, fmt.Errorf("enabled package not found: %s", name)
+	}
+
+	err := filepath.Walk(pkg.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(pkg.root, path)
+		if err != nil || relPath == "." {
+			return err
+		}
+
+		// Ignore rules are relative to the repository root
+		if ignore.Match(filepath.Join(name, relPath), info.IsDir()) {
+			for dir := filepath.Dir(relPath); dir != "."; dir = filepath.Dir(dir) {
+				pkg.unfoldable[dir] = true
+			}
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		// Variants and files that aren't symlinked can't live inside a folded directory
+		base, conditions := splitVariant(relPath)
+		if conditions != "" || modes.modeFor(base) != ModeSymlink {
+			for dir := filepath.Dir(relPath); dir != "."; dir = filepath.Dir(dir) {
+				pkg.unfoldable[dir] = true
+			}
+		}
+
+		pkg.files = append(pkg.files, relPath)
+		return nil
+	})
+
+	if err != nil {
+		return pkg, fmt.Errorf("failed to read package %s: %w", name, err)
+	}
+
+	return pkg, nil
+}
+
+// foldableDir returns the highest ancestor directory of file that can be
+// linked as a whole, or "" if the file has to be linked on its own
+func foldableDir(pkg packageFiles, file string, owners map[string]map[string]bool, homeDir string) string {
+	// Collect ancestors from the top down
+	var dirs []string
+	for dir := filepath.Dir(file); dir != "."; dir = filepath.Dir(dir) {
+		dirs = append([]string{dir}, dirs...)
+	}
+
+	for _, dir := range dirs {
+		if len(owners[dir]) != 1 || pkg.unfoldable[dir] {
+			continue
+		}
+
+		target := filepath.Join(homeDir, dir)
+		info, err := os.Lstat(target)
+		if os.IsNotExist(err) {
+			return dir
+		}
+
+		// An existing fold of this same directory is kept
+		if err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if dest, err := os.Readlink(target); err == nil && dest == filepath.Join(pkg.root, dir) {
+				return dir
+			}
+		}
+
+		// A real directory exists, so nothing below it can fold either
+		if err == nil && info.IsDir() {
+			continue
+		}
+
+		return ""
+	}
+
+	return ""
+}
+
+// unlinkPackage removes every link in the home directory that points into
+// the package, whether it is a file link or a folded directory
+func unlinkPackage(root, homeDir string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil || relPath == "." {
+			return err
+		}
+
+		target := filepath.Join(homeDir, relPath)
+		if dest, err := os.Readlink(target); err == nil && dest == path {
+			if err := os.Remove(target); err != nil {
+				return err
+			}
+			fmt.Printf("Unlinked %s\n", target)
+
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+		}
+
+		return nil
+	})
+}
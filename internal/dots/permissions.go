@@ -0,0 +1,155 @@
+package dots
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// MetadataDir is the directory in the dotfiles repository reserved for milo
+const MetadataDir = ".milo"
+
+// PermissionsFile records the modes of added files and directories that git
+// can't restore by itself, relative to the dotfiles directory
+var PermissionsFile = filepath.Join(MetadataDir, "permissions.yaml")
+
+// PermissionEntry is a single mode recorded in PermissionsFile
+type PermissionEntry struct {
+	Path string
+	Mode string
+}
+
+// permissions maps paths relative to the dotfiles directory to their modes
+type permissions map[string]os.FileMode
+
+// loadPermissions reads PermissionsFile from the dotfiles directory
+func loadPermissions(dir string) (permissions, error) {
+	perms := make(permissions)
+
+	path := filepath.Join(dir, PermissionsFile)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return perms, nil
+	}
+
+	permsViper := viper.New()
+	permsViper.SetConfigFile(path)
+	if err := permsViper.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", PermissionsFile, err)
+	}
+
+	var entries []PermissionEntry
+	if err := permsViper.UnmarshalKey("permissions", &entries); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", PermissionsFile, err)
+	}
+
+	for _, entry := range entries {
+		mode, err := strconv.ParseUint(entry.Mode, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mode %q for %s", entry.Mode, entry.Path)
+		}
+		perms[filepath.FromSlash(entry.Path)] = os.FileMode(mode).Perm()
+	}
+
+	return perms, nil
+}
+
+// save writes PermissionsFile to the dotfiles directory
+func (p permissions) save(dir string) error {
+	entries := make([]PermissionEntry, 0, len(p))
+	for path, mode := range p {
+		entries = append(entries, PermissionEntry{
+			Path: filepath.ToSlash(path),
+			Mode: fmt.Sprintf("%04o", mode.Perm()),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+
+	path := filepath.Join(dir, PermissionsFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", MetadataDir, err)
+	}
+
+	permsViper := viper.New()
+	permsViper.SetConfigFile(path)
+	permsViper.Set("permissions", entries)
+
+	if err := permsViper.WriteConfig(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", PermissionsFile, err)
+	}
+
+	return nil
+}
+
+// record remembers the mode of a path if git wouldn't restore it on its own
+func (p permissions) record(repoPath string, mode os.FileMode, isDir bool) {
+	perm := mode.Perm()
+	if (isDir && perm == 0755) || (!isDir && (perm == 0644 || perm == 0755)) {
+		delete(p, repoPath)
+		return
+	}
+	p[repoPath] = perm
+}
+
+// restore applies the recorded modes to the files in the dotfiles directory,
+// which a fresh clone creates with the default umask
+func (p permissions) restore(dir string) error {
+	for repoPath, mode := range p {
+		path := filepath.Join(dir, repoPath)
+
+		info, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if info.Mode()&os.ModeSymlink == 0 && info.Mode().Perm() != mode {
+			if err := os.Chmod(path, mode); err != nil {
+				return fmt.Errorf("failed to restore mode of %s: %w", repoPath, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// restoreDirs applies recorded directory modes to the matching directories in
+// the home directory. In the packages layout the package name is stripped.
+func (p permissions) restoreDirs(dir, homeDir, layout string) error {
+	for repoPath, mode := range p {
+		info, err := os.Stat(filepath.Join(dir, repoPath))
+		if err != nil || !info.IsDir() {
+			continue
+		}
+
+		relPath := repoPath
+		if layout == LayoutPackages {
+			_, rest, ok := strings.Cut(filepath.ToSlash(repoPath), "/")
+			if !ok {
+				continue
+			}
+			relPath = filepath.FromSlash(rest)
+		}
+
+		target := filepath.Join(homeDir, relPath)
+		targetInfo, err := os.Lstat(target)
+		if err != nil || !targetInfo.IsDir() || targetInfo.Mode().Perm() == mode {
+			continue
+		}
+
+		if err := os.Chmod(target, mode); err != nil {
+			return fmt.Errorf("failed to restore mode of %s: %w", target, err)
+		}
+	}
+
+	return nil
+}
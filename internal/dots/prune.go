@@ -0,0 +1,147 @@
+package dots
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+)
+
+// UnlinkOptions defines options for removing managed targets
+type UnlinkOptions struct {
+	// Remove copies that were edited since they were deployed
+	Force bool
+}
+
+// PruneOptions defines options for cleaning up orphaned targets
+type PruneOptions struct {
+	// Only report what would be removed
+	DryRun bool
+
+	// Remove orphaned copies that were edited since they were deployed
+	Force bool
+}
+
+// Unlink removes managed targets from the home directory
+func Unlink(targets ...string) error {
+	return UnlinkWithOptions(UnlinkOptions{}, targets...)
+}
+
+// UnlinkWithOptions removes the given managed targets from the home directory
+// and forgets them. Without targets every managed target is removed.
+func UnlinkWithOptions(options UnlinkOptions, targets ...string) error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+
+	state, err := loadState(cfg)
+	if err != nil {
+		return err
+	}
+
+	var files []DeployedFile
+	if len(targets) == 0 {
+		files = state.sorted()
+	}
+
+	for _, target := range targets {
+		absPath, err := filepath.Abs(target)
+		if err != nil {
+			return fmt.Errorf("failed to get absolute path: %w", err)
+		}
+
+		file, ok := state.Files[absPath]
+		if !ok {
+			return fmt.Errorf("not managed by dotfiles: %s", absPath)
+		}
+		files = append(files, file)
+	}
+
+	for _, file := range files {
+		if err := forget(state, file, options.Force, "Unlinked"); err != nil {
+			return err
+		}
+	}
+
+	return state.save()
+}
+
+// Prune removes targets whose source no longer exists or is no longer
+// deployed to this machine
+func Prune() ([]DeployedFile, error) {
+	return PruneWithOptions(PruneOptions{})
+}
+
+// PruneWithOptions removes orphaned targets with options and returns them
+func PruneWithOptions(options PruneOptions) ([]DeployedFile, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+
+	// Check if dotfiles directory exists
+	if _, err := os.Stat(cfg.DotfilesDir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("dotfiles directory not found: %s", cfg.DotfilesDir)
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	links, err := planLinks(cfg, homeDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune dotfiles: %w", err)
+	}
+
+	state, err := loadState(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	orphans := state.orphans(links)
+	if options.DryRun {
+		return orphans, nil
+	}
+
+	if err := pruneOrphans(state, orphans, options.Force); err != nil {
+		return nil, err
+	}
+
+	return orphans, state.save()
+}
+
+// pruneOrphans removes orphaned targets and forgets them
+func pruneOrphans(state *State, orphans []DeployedFile, force bool) error {
+	for _, file := range orphans {
+		if err := forget(state, file, force, "Pruned"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forget removes a managed target and drops it from the state. Edited
+// targets stay managed until they are removed with force; targets replaced by
+// something else are left alone and forgotten.
+func forget(state *State, file DeployedFile, force bool, verb string) error {
+	removed, err := file.remove(force)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case removed:
+		fmt.Printf("%s %s\n", verb, file.Target)
+	case file.edited():
+		fmt.Printf("Kept %s: edited since it was deployed, use force to remove\n", file.Target)
+		return nil
+	default:
+		fmt.Printf("Forgot %s: replaced since it was deployed\n", file.Target)
+	}
+
+	delete(state.Files, file.Target)
+	return nil
+}
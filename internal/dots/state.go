@@ -0,0 +1,225 @@
+package dots
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/version"
+	"github.com/spf13/viper"
+)
+
+// StateFile is the file under the config directory where dots records every
+// target it manages in the home directory
+const StateFile = "dots_state.yaml"
+
+// DeployedFile records a target milo deployed, so later runs can tell whether
+// it was edited and clean it up once its source is gone
+type DeployedFile struct {
+	Target  string
+	Source  string
+	Package string
+	Mode    string
+
+	// SHA-256 of the deployed content; empty for symlinks
+	Checksum string
+
+	// When the target was last deployed, in RFC 3339 format
+	DeployedAt string
+
+	// Version of milo that deployed the target
+	Version string
+}
+
+// State holds the managed targets keyed by target path and the hooks that ran
+type State struct {
+	path  string
+	Files map[string]DeployedFile
+	Hooks map[string]HookRun
+}
+
+// loadState reads the dots state file, returning an empty state if it doesn't exist yet
+func loadState(cfg *config.Config) (*State, error) {
+	state := &State{
+		path:  filepath.Join(cfg.ConfigDir, StateFile),
+		Files: make(map[string]DeployedFile),
+		Hooks: make(map[string]HookRun),
+	}
+
+	if _, err := os.Stat(state.path); os.IsNotExist(err) {
+		return state, nil
+	}
+
+	stateViper := viper.New()
+	stateViper.SetConfigFile(state.path)
+	if err := stateViper.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read dots state: %w", err)
+	}
+
+	var files []DeployedFile
+	if err := stateViper.UnmarshalKey("files", &files); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dots state: %w", err)
+	}
+
+	for _, file := range files {
+		state.Files[file.Target] = file
+	}
+
+	var hooks []HookRun
+	if err := stateViper.UnmarshalKey("hooks", &hooks); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dots state: %w", err)
+	}
+
+	for _, run := range hooks {
+		h := hook{RelPath: run.Path, Kind: run.Kind, Checksum: run.Checksum}
+		state.Hooks[h.key()] = run
+	}
+
+	return state, nil
+}
+
+// save writes the state file, sorted by target for stable diffs
+func (s *State) save() error {
+	files := s.sorted()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	stateViper := viper.New()
+	stateViper.SetConfigFile(s.path)
+	stateViper.Set("files", files)
+	stateViper.Set("hooks", s.sortedHooks())
+
+	if err := stateViper.WriteConfig(); err != nil {
+		return fmt.Errorf("failed to write dots state: %w", err)
+	}
+
+	return nil
+}
+
+// sorted returns the managed targets ordered by path
+func (s *State) sorted() []DeployedFile {
+	files := make([]DeployedFile, 0, len(s.Files))
+	for _, file := range s.Files {
+		files = append(files, file)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Target < files[j].Target
+	})
+
+	return files
+}
+
+// sortedHooks returns the hook runs ordered by path
+func (s *State) sortedHooks() []HookRun {
+	hooks := make([]HookRun, 0, len(s.Hooks))
+	for _, run := range s.Hooks {
+		hooks = append(hooks, run)
+	}
+
+	sort.Slice(hooks, func(i, j int) bool {
+		if hooks[i].Path != hooks[j].Path {
+			return hooks[i].Path < hooks[j].Path
+		}
+		return hooks[i].RanAt < hooks[j].RanAt
+	})
+
+	return hooks
+}
+
+// checksumFor returns the recorded checksum for target, if any
+func (s *State) checksumFor(target string) string {
+	return s.Files[target].Checksum
+}
+
+// record stores a freshly deployed link
+func (s *State) record(l link, sum string) {
+	s.Files[l.Target] = DeployedFile{
+		Target:     l.Target,
+		Source:     l.Source,
+		Package:    l.Package,
+		Mode:       l.Mode,
+		Checksum:   sum,
+		DeployedAt: time.Now().UTC().Format(time.RFC3339),
+		Version:    version.Version,
+	}
+}
+
+// orphans returns the recorded targets that the current plan no longer
+// deploys, because their source was deleted, renamed or its package disabled
+func (s *State) orphans(links []link) []DeployedFile {
+	planned := make(map[string]bool, len(links))
+	for _, l := range links {
+		planned[l.Target] = true
+	}
+
+	var orphans []DeployedFile
+	for _, file := range s.sorted() {
+		if !planned[file.Target] {
+			orphans = append(orphans, file)
+		}
+	}
+
+	return orphans
+}
+
+// owned reports whether the target is still exactly what milo deployed, so it
+// can be removed without losing anything
+func (f DeployedFile) owned() bool {
+	info, err := os.Lstat(f.Target)
+	if err != nil {
+		return false
+	}
+
+	switch f.Mode {
+	case ModeHardlink:
+		// Edits through either name change both, so compare identity first
+		if sourceInfo, err := os.Stat(f.Source); err == nil && os.SameFile(info, sourceInfo) {
+			return true
+		}
+		fallthrough
+	case ModeCopy, ModeTemplate, ModeEncrypted:
+		if info.Mode()&os.ModeSymlink != 0 || f.Checksum == "" {
+			return false
+		}
+		current, err := fileChecksum(f.Target)
+		return err == nil && current == f.Checksum
+	default:
+		dest, err := os.Readlink(f.Target)
+		return err == nil && dest == f.Source
+	}
+}
+
+// edited reports whether a copied, rendered or hard linked target was changed
+// in place since it was deployed, as opposed to replaced by something else
+func (f DeployedFile) edited() bool {
+	info, err := os.Lstat(f.Target)
+	if err != nil || f.Mode == ModeSymlink || info.Mode()&os.ModeSymlink != 0 {
+		return false
+	}
+	return !f.owned()
+}
+
+// remove deletes a managed target from the home directory. Edited targets are
+// only removed with force, and targets replaced by something else are never
+// removed. It reports whether the target is gone afterwards.
+func (f DeployedFile) remove(force bool) (bool, error) {
+	if _, err := os.Lstat(f.Target); os.IsNotExist(err) {
+		return true, nil
+	}
+
+	if !f.owned() && !(force && f.edited()) {
+		return false, nil
+	}
+
+	if err := os.Remove(f.Target); err != nil {
+		return false, fmt.Errorf("failed to remove %s: %w", f.Target, err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,115 @@
+package dots
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+)
+
+// LinkState describes how a target in the home directory relates to its source
+type LinkState string
+
+const (
+	// StateLinked means the target is a symlink to its source
+	StateLinked LinkState = "linked"
+	// StateMissing means the target does not exist yet
+	StateMissing LinkState = "missing"
+	// StateConflict means the target exists but is not managed by milo
+	StateConflict LinkState = "conflict"
+	// StateModified means a copied or rendered target was edited after milo deployed it
+	StateModified LinkState = "modified"
+	// StateOutdated means the source changed since the target was copied or rendered
+	StateOutdated LinkState = "outdated"
+	// StateOrphaned means milo deployed the target but its source is gone or no
+	// longer deployed to this machine; apply and prune remove it
+	StateOrphaned LinkState = "orphaned"
+)
+
+// StatusEntry describes the state of a single dotfile
+type StatusEntry struct {
+	// Package the dotfile belongs to, empty in the flat layout
+	Package string
+
+	// Path relative to the home directory
+	RelPath string
+
+	// Absolute path of the file in the dotfiles directory
+	Source string
+
+	// Absolute path of the file in the home directory
+	Target string
+
+	// Link mode used to deploy the target
+	Mode string
+
+	// Conditions of the selected variant and why it was selected
+	Variant string
+	Reason  string
+
+	State LinkState
+}
+
+// Status reports the state of every dotfile that Apply would link, followed
+// by the managed targets it would prune
+func Status() ([]StatusEntry, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+
+	// Check if dotfiles directory exists
+	if _, err := os.Stat(cfg.DotfilesDir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("dotfiles directory not found: %s", cfg.DotfilesDir)
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	links, err := planLinks(cfg, homeDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dotfiles status: %w", err)
+	}
+
+	state, err := loadState(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := newDeployContext(cfg, homeDir)
+
+	entries := make([]StatusEntry, 0, len(links))
+	for _, l := range links {
+		entries = append(entries, StatusEntry{
+			Package: l.Package,
+			RelPath: l.RelPath,
+			Source:  l.Source,
+			Target:  l.Target,
+			Mode:    l.Mode,
+			Variant: l.Variant,
+			Reason:  l.Reason,
+			State:   linkState(l, state.checksumFor(l.Target), ctx),
+		})
+	}
+
+	for _, file := range state.orphans(links) {
+		relPath, err := filepath.Rel(homeDir, file.Target)
+		if err != nil {
+			relPath = file.Target
+		}
+
+		entries = append(entries, StatusEntry{
+			Package: file.Package,
+			RelPath: relPath,
+			Source:  file.Source,
+			Target:  file.Target,
+			Mode:    file.Mode,
+			State:   StateOrphaned,
+		})
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,273 @@
+package dots
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/platform"
+)
+
+// SyncOptions defines options for syncing the dotfiles repository
+type SyncOptions struct {
+	// Commit message, generated from the changed paths when empty
+	Message string
+
+	// Commit and pull, but don't push
+	NoPush bool
+}
+
+// ConflictError is returned when pulling stops on conflicting changes
+type ConflictError struct {
+	Dir   string
+	Paths []string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflicts in %s, resolve them in %s and run 'git rebase --continue', or 'git rebase --abort' to undo the pull",
+		strings.Join(e.Paths, ", "), e.Dir)
+}
+
+// Sync commits local changes, pulls, pushes and applies dotfiles
+func Sync() error {
+	return SyncWithOptions(SyncOptions{})
+}
+
+// SyncWithOptions commits changes to managed files, pulls with rebase, pushes
+// and re-applies dotfiles if the pull brought in new changes. Only the sources
+// of deployed targets are committed.
+func SyncWithOptions(options SyncOptions) error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get config: %w", err)
+	}
+
+	// Check if dotfiles directory exists
+	if _, err := os.Stat(cfg.DotfilesDir); os.IsNotExist(err) {
+		return fmt.Errorf("dotfiles directory not found: %s", cfg.DotfilesDir)
+	}
+
+	// Check if it's a git repository
+	gitDir := filepath.Join(cfg.DotfilesDir, ".git")
+	if _, err := os.Stat(gitDir); os.IsNotExist(err) {
+		return fmt.Errorf("not a git repository: %s", cfg.DotfilesDir)
+	}
+
+	// A rebase left over from an earlier conflict has to be finished first
+	if conflicts := conflictedPaths(cfg.DotfilesDir); len(conflicts) > 0 {
+		return &ConflictError{Dir: cfg.DotfilesDir, Paths: conflicts}
+	}
+
+	// Bring edits to copied files back into the repository
+	if err := collectCopies(cfg); err != nil {
+		return err
+	}
+
+	changed, err := changedPaths(cfg.DotfilesDir)
+	if err != nil {
+		return fmt.Errorf("failed to read dotfiles changes: %w", err)
+	}
+
+	// Other changes in the repository, staged or not, are left to the user
+	changed, err = managedPaths(cfg, changed)
+	if err != nil {
+		return err
+	}
+
+	if len(changed) > 0 {
+		if err := checkGitIdentity(cfg.DotfilesDir); err != nil {
+			return err
+		}
+
+		message := options.Message
+		if message == "" {
+			message = syncMessage(changed)
+		}
+
+		if _, err := git(cfg.DotfilesDir, append([]string{"add", "--"}, changed...)...); err != nil {
+			return fmt.Errorf("failed to stage changes: %w", err)
+		}
+
+		if _, err := git(cfg.DotfilesDir, append([]string{"commit", "-m", message, "--"}, changed...)...); err != nil {
+			return fmt.Errorf("failed to commit changes: %w", err)
+		}
+
+		fmt.Printf("Committed %d changed files\n", len(changed))
+	} else {
+		fmt.Println("No local changes to commit")
+	}
+
+	remotes, err := git(cfg.DotfilesDir, "remote")
+	if err != nil || strings.TrimSpace(remotes) == "" {
+		fmt.Println("No remote configured, skipping pull and push")
+		return nil
+	}
+
+	before, _ := git(cfg.DotfilesDir, "rev-parse", "HEAD")
+
+	// Pull with rebase, so local commits stay on top of the remote history
+	if _, err := git(cfg.DotfilesDir, "pull", "--rebase", "--autostash"); err != nil {
+		if conflicts := conflictedPaths(cfg.DotfilesDir); len(conflicts) > 0 {
+			return &ConflictError{Dir: cfg.DotfilesDir, Paths: conflicts}
+		}
+		return fmt.Errorf("failed to pull dotfiles: %w", err)
+	}
+
+	after, _ := git(cfg.DotfilesDir, "rev-parse", "HEAD")
+	pulled := strings.TrimSpace(before) != strings.TrimSpace(after)
+	if pulled {
+		fmt.Println("Pulled remote changes")
+	} else {
+		fmt.Println("Already up to date")
+	}
+
+	if !options.NoPush {
+		if _, err := git(cfg.DotfilesDir, "push"); err != nil {
+			return fmt.Errorf("failed to push dotfiles: %w", err)
+		}
+		fmt.Println("Pushed dotfiles")
+	}
+
+	// Link files added on other machines and prune the ones they removed
+	if pulled {
+		if err := Apply(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// changedPaths lists tracked files in the repository with uncommitted changes
+func changedPaths(dir string) ([]string, error) {
+	output, err := git(dir, "status", "--porcelain", "-z", "--untracked-files=no")
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	records := strings.Split(output, "\x00")
+	for i := 0; i < len(records); i++ {
+		record := records[i]
+		if len(record) < 4 {
+			continue
+		}
+
+		paths = append(paths, record[3:])
+
+		// Renames and copies are followed by the original path
+		if record[0] == 'R' || record[0] == 'C' {
+			i++
+		}
+	}
+
+	return paths, nil
+}
+
+// managedPaths returns the paths that are the source of a target in the dots
+// state, keeping their order
+func managedPaths(cfg *config.Config, paths []string) ([]string, error) {
+	state, err := loadState(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := make(map[string]bool)
+	for _, file := range state.Files {
+		if relPath, err := filepath.Rel(cfg.DotfilesDir, file.Source); err == nil {
+			sources[filepath.ToSlash(relPath)] = true
+		}
+	}
+
+	var managed []string
+	for _, path := range paths {
+		if sources[path] {
+			managed = append(managed, path)
+		}
+	}
+	return managed, nil
+}
+
+// conflictedPaths lists files with unresolved merge conflicts
+func conflictedPaths(dir string) []string {
+	output, err := git(dir, "diff", "--name-only", "--diff-filter=U")
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(output)
+}
+
+// syncMessage generates a commit message listing the changed paths
+func syncMessage(paths []string) string {
+	subject := fmt.Sprintf("Update %s", strings.Join(paths, ", "))
+	if len(paths) > 3 {
+		subject = fmt.Sprintf("Update %s and %d more", strings.Join(paths[:3], ", "), len(paths)-3)
+	}
+
+	if host := platform.Detect().Hostname; host != "" {
+		subject += fmt.Sprintf(" from %s", host)
+	}
+
+	var body strings.Builder
+	for _, path := range paths {
+		body.WriteString("- " + path + "\n")
+	}
+
+	return subject + "\n\n" + body.String()
+}
+
+// collectCopies copies edited copy-mode targets back over their sources, as
+// long as the source didn't change since it was deployed. Edited templates
+// and decrypted files can't be mapped back and are only reported.
+func collectCopies(cfg *config.Config) error {
+	state, err := loadState(cfg)
+	if err != nil {
+		return err
+	}
+
+	collected := false
+	for _, file := range state.sorted() {
+		if !file.edited() || file.Mode == ModeHardlink {
+			continue
+		}
+
+		if file.Mode != ModeCopy {
+			fmt.Printf("Skipped %s: edited %s target can't be synced, change %s instead\n", file.Target, file.Mode, file.Source)
+			continue
+		}
+
+		sourceSum, err := fileChecksum(file.Source)
+		if err != nil {
+			continue
+		}
+		if sourceSum != file.Checksum {
+			fmt.Printf("Skipped %s: both the copy and %s changed\n", file.Target, file.Source)
+			continue
+		}
+
+		if err := copyFile(file.Target, file.Source); err != nil {
+			return fmt.Errorf("failed to copy %s back: %w", file.Target, err)
+		}
+
+		sum, err := fileChecksum(file.Source)
+		if err != nil {
+			return err
+		}
+
+		file.Checksum = sum
+		file.DeployedAt = time.Now().UTC().Format(time.RFC3339)
+		state.Files[file.Target] = file
+		collected = true
+
+		fmt.Printf("Collected %s\n", file.Target)
+	}
+
+	if !collected {
+		return nil
+	}
+
+	return state.save()
+}
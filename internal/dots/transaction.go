@@ -0,0 +1,246 @@
+package dots
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bayou-brogrammer/mygo/internal/shell"
+)
+
+// transaction records how to undo each step of a multi-step change, so a
+// failure halfway can put everything back the way it was
+type transaction struct {
+	undo []func() error
+
+	// Backups of replaced files, removed once the transaction commits
+	backups []string
+}
+
+// onRollback registers a step to run if the transaction is rolled back.
+// Steps run in reverse order of registration.
+func (tx *transaction) onRollback(fn func() error) {
+	tx.undo = append(tx.undo, fn)
+}
+
+// rollback undoes every registered step and returns any errors doing so
+func (tx *transaction) rollback() error {
+	var errs []error
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		if err := tx.undo[i](); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	tx.undo = nil
+	tx.backups = nil
+	return errors.Join(errs...)
+}
+
+// commit makes the transaction permanent and drops the backups it kept
+func (tx *transaction) commit() {
+	for _, backup := range tx.backups {
+		os.Remove(backup)
+	}
+	tx.undo = nil
+	tx.backups = nil
+}
+
+// fail rolls the transaction back and returns err, along with any errors
+// from the rollback itself
+func (tx *transaction) fail(err error) error {
+	if rollbackErr := tx.rollback(); rollbackErr != nil {
+		return fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+	}
+	return err
+}
+
+// mkdirAll creates path and any missing parents, removing the ones it
+// created on rollback
+func (tx *transaction) mkdirAll(path string, perm os.FileMode) error {
+	var created []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if _, err := os.Lstat(dir); err == nil {
+			break
+		}
+		created = append(created, dir)
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+
+	if err := os.MkdirAll(path, perm); err != nil {
+		return err
+	}
+
+	// Deepest first, and only if they are empty again
+	tx.onRollback(func() error {
+		for _, dir := range created {
+			os.Remove(dir)
+		}
+		return nil
+	})
+
+	return nil
+}
+
+// preserve arranges for the file at path to be restored to its current
+// content and mode on rollback, or removed if it doesn't exist yet
+func (tx *transaction) preserve(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		tx.onRollback(func() error {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		dest, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		tx.onRollback(func() error {
+			os.Remove(path)
+			return os.Symlink(dest, path)
+		})
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	tx.onRollback(func() error {
+		return writeFileAtomic(path, data, info.Mode().Perm())
+	})
+	return nil
+}
+
+// swapSymlink atomically replaces the file at path with a symlink to dest.
+// The original is kept as a hard link (or copy) until the transaction
+// commits and is renamed back over the symlink on rollback.
+func (tx *transaction) swapSymlink(path, dest string) error {
+	backup := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".milo-backup")
+	os.Remove(backup)
+
+	if err := os.Link(path, backup); err != nil {
+		if err := copyFile(path, backup); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", path, err)
+		}
+	}
+
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".milo-link")
+	os.Remove(tmp)
+
+	if err := os.Symlink(dest, tmp); err != nil {
+		os.Remove(backup)
+		return err
+	}
+
+	// rename replaces the original in one step, so path always exists
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		os.Remove(backup)
+		return err
+	}
+
+	tx.backups = append(tx.backups, backup)
+	tx.onRollback(func() error {
+		return os.Rename(backup, path)
+	})
+
+	return nil
+}
+
+// chmod changes the mode of path, restoring the previous mode on rollback
+func (tx *transaction) chmod(path string, mode os.FileMode) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(path, mode); err != nil {
+		return err
+	}
+
+	tx.onRollback(func() error {
+		return os.Chmod(path, info.Mode().Perm())
+	})
+	return nil
+}
+
+// gitCommit stages paths in the repository at dir and commits only them. On
+// rollback the commit is undone and the paths are unstaged.
+func (tx *transaction) gitCommit(dir, message string, verbose bool, paths ...string) error {
+	head, headErr := git(dir, "rev-parse", "--verify", "-q", "HEAD")
+	head = strings.TrimSpace(head)
+
+	tx.onRollback(func() error {
+		if headErr != nil {
+			// No commits before this one
+			git(dir, "update-ref", "-d", "HEAD")
+			_, err := git(dir, append([]string{"rm", "-r", "-q", "--cached", "--ignore-unmatch", "--"}, paths...)...)
+			return err
+		}
+		_, err := git(dir, "reset", "-q", "--soft", head)
+		if err != nil {
+			return err
+		}
+		_, err = git(dir, append([]string{"reset", "-q", "--"}, paths...)...)
+		return err
+	})
+
+	if _, err := git(dir, append([]string{"add", "--"}, paths...)...); err != nil {
+		return fmt.Errorf("failed to add files to git: %w", err)
+	}
+
+	// Only the paths are committed, so changes the user staged stay staged
+	result, err := shell.ExecuteInDir(dir, "git", append([]string{"commit", "-m", message, "--"}, paths...)...)
+	if err != nil {
+		return fmt.Errorf("failed to commit changes: %w", withStderr(result, err))
+	}
+
+	shell.PrintResult(result, verbose)
+	return nil
+}
+
+// git runs git in dir and returns its output, including stderr in the error
+func git(dir string, args ...string) (string, error) {
+	result, err := shell.ExecuteInDir(dir, "git", args...)
+	if err != nil {
+		return result.Stdout, withStderr(result, err)
+	}
+	return result.Stdout, nil
+}
+
+// withStderr adds the stderr of a failed command to its error
+func withStderr(result *shell.Result, err error) error {
+	if stderr := strings.TrimSpace(result.Stderr); stderr != "" {
+		return fmt.Errorf("%w: %s", err, stderr)
+	}
+	return err
+}
+
+// checkGitIdentity fails early when git has no author configured, which
+// would otherwise only surface when committing
+func checkGitIdentity(dir string) error {
+	if os.Getenv("GIT_AUTHOR_NAME") != "" && os.Getenv("GIT_AUTHOR_EMAIL") != "" {
+		return nil
+	}
+
+	for _, key := range []string{"user.name", "user.email"} {
+		if value, err := git(dir, "config", key); err != nil || strings.TrimSpace(value) == "" {
+			return fmt.Errorf("git %s is not set in %s, run 'git config --global %s <value>'", key, dir, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package dots
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bayou-brogrammer/mygo/internal/platform"
+)
+
+// VariantSeparator separates a dotfile name from the conditions that select
+// it, as in ".gitconfig##os.darwin" or ".zshrc##host.buildbox,tag.work"
+const VariantSeparator = "##"
+
+// variantWeights rank conditions by how specific they are; the variant with
+// the highest total weight wins
+var variantWeights = map[string]int{
+	"os":     1,
+	"distro": 2,
+	"tag":    4,
+	"host":   8,
+}
+
+// variantFacts are the machine properties variant conditions are checked against
+type variantFacts struct {
+	facts platform.Facts
+	tags  []string
+}
+
+// matches reports whether a single kind.value condition holds on this machine
+func (f variantFacts) matches(kind, value string) (bool, error) {
+	switch kind {
+	case "os":
+		return strings.EqualFold(value, f.facts.OS), nil
+	case "distro":
+		return f.facts.Distro.Is(value), nil
+	case "tag":
+		return slices.Contains(f.tags, value), nil
+	case "host":
+		return strings.EqualFold(value, f.facts.Hostname), nil
+	default:
+		return false, fmt.Errorf("unknown variant condition %q", kind)
+	}
+}
+
+// splitVariant splits a relative path into the path without its variant
+// suffix and the conditions of the suffix. A template or encryption suffix
+// after the conditions, as in ".netrc##host.buildbox.encrypted", stays with
+// the path.
+func splitVariant(relPath string) (string, string) {
+	dir, name := filepath.Split(relPath)
+	base, conditions, ok := strings.Cut(name, VariantSeparator)
+	if !ok {
+		return relPath, ""
+	}
+
+	for _, suffix := range []string{EncryptedSuffix, TemplateSuffix} {
+		if trimmed, ok := strings.CutSuffix(conditions, suffix); ok {
+			base += suffix
+			conditions = trimmed
+			break
+		}
+	}
+
+	return filepath.Join(dir, base), conditions
+}
+
+// scoreVariant checks every condition of a variant and returns its weight,
+// or -1 if any condition doesn't hold
+func scoreVariant(conditions string, facts variantFacts) (int, error) {
+	score := 0
+	for _, condition := range strings.Split(conditions, ",") {
+		kind, value, ok := strings.Cut(strings.TrimSpace(condition), ".")
+		if !ok || value == "" {
+			return -1, fmt.Errorf("invalid variant condition %q, expected kind.value", condition)
+		}
+
+		matched, err := facts.matches(kind, value)
+		if err != nil {
+			return -1, err
+		}
+		if !matched {
+			return -1, nil
+		}
+
+		score += variantWeights[kind]
+	}
+
+	return score, nil
+}
+
+// resolveVariants keeps the most specific matching variant of every file and
+// drops the others; links without variants pass through unchanged
+func resolveVariants(links []link, homeDir string, facts variantFacts) ([]link, error) {
+	type candidate struct {
+		link  link
+		score int
+	}
+
+	var order []string
+	candidates := make(map[string][]candidate)
+
+	for _, l := range links {
+		base, conditions := splitVariant(l.RelPath)
+		if l.Dir || conditions == "" {
+			base, conditions = l.RelPath, ""
+		}
+
+		score := 0
+		if conditions != "" {
+			var err error
+			score, err = scoreVariant(conditions, facts)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", l.Source, err)
+			}
+		}
+
+		key := l.Package + "\x00" + base
+		if _, seen := candidates[key]; !seen {
+			order = append(order, key)
+		}
+
+		l.RelPath = base
+		l.Target = filepath.Join(homeDir, base)
+		l.Variant = conditions
+		candidates[key] = append(candidates[key], candidate{link: l, score: score})
+	}
+
+	resolved := make([]link, 0, len(order))
+	for _, key := range order {
+		total := len(candidates[key])
+		matching := slices.DeleteFunc(candidates[key], func(c candidate) bool { return c.score < 0 })
+		if len(matching) == 0 {
+			continue
+		}
+
+		// Highest score wins, ties go to the first variant by name
+		sort.SliceStable(matching, func(i, j int) bool {
+			if matching[i].score != matching[j].score {
+				return matching[i].score > matching[j].score
+			}
+			return matching[i].link.Source < matching[j].link.Source
+		})
+
+		chosen := matching[0].link
+		chosen.Reason = variantReason(chosen.Variant, total, len(matching) > 1 && matching[1].score == matching[0].score)
+		resolved = append(resolved, chosen)
+	}
+
+	return resolved, nil
+}
+
+// variantReason explains why a variant was selected
+func variantReason(conditions string, total int, tie bool) string {
+	if total == 1 && conditions == "" {
+		return ""
+	}
+
+	if conditions == "" {
+		return "default, no variant matches this machine"
+	}
+
+	reason := fmt.Sprintf("matches %s", strings.ReplaceAll(conditions, ",", ", "))
+	if total > 1 {
+		reason += fmt.Sprintf(", most specific of %d variants", total)
+	}
+	if tie {
+		reason += ", tied and chosen by name"
+	}
+
+	return reason
+}
@@ -0,0 +1,83 @@
+package platform
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// OSReleaseFile is the file that describes the running Linux distribution
+const OSReleaseFile = "/etc/os-release"
+
+// Distro describes a Linux distribution as reported by os-release
+type Distro struct {
+	// Lowercase identifier such as "ubuntu" or "fedora"
+	ID string
+
+	// Identifiers of the distributions this one derives from, such as "debian"
+	IDLike []string
+
+	// Version identifier such as "24.04"
+	VersionID string
+
+	// Human readable name such as "Ubuntu 24.04 LTS"
+	PrettyName string
+}
+
+// Is reports whether the distribution is id or derives from it
+func (d Distro) Is(id string) bool {
+	if strings.EqualFold(d.ID, id) {
+		return true
+	}
+
+	for _, like := range d.IDLike {
+		if strings.EqualFold(like, id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DetectDistro reads the distribution from OSReleaseFile. It returns an
+// empty Distro on systems without one, such as macOS.
+func DetectDistro() Distro {
+	file, err := os.Open(OSReleaseFile)
+	if err != nil {
+		return Distro{}
+	}
+	defer file.Close()
+
+	return ParseOSRelease(bufio.NewScanner(file))
+}
+
+// ParseOSRelease parses the KEY=value lines of an os-release file
+func ParseOSRelease(scanner *bufio.Scanner) Distro {
+	var distro Distro
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"'`)
+
+		switch key {
+		case "ID":
+			distro.ID = strings.ToLower(value)
+		case "ID_LIKE":
+			distro.IDLike = strings.Fields(strings.ToLower(value))
+		case "VERSION_ID":
+			distro.VersionID = value
+		case "PRETTY_NAME":
+			distro.PrettyName = value
+		}
+	}
+
+	return distro
+}
@@ -0,0 +1,49 @@
+package platform
+
+import (
+	"os"
+	"os/user"
+	"runtime"
+	"strings"
+)
+
+// Facts describes the machine milo is running on
+type Facts struct {
+	Hostname string
+	OS       string
+	Arch     string
+	User     string
+	Home     string
+
+	// Linux distribution, empty on other systems
+	Distro Distro
+}
+
+// Detect gathers facts about the current machine
+func Detect() Facts {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = ""
+	}
+
+	// Only keep the short host name so "buildbox.local" matches "buildbox"
+	if i := strings.Index(hostname, "."); i > 0 {
+		hostname = hostname[:i]
+	}
+
+	username := os.Getenv("USER")
+	if current, err := user.Current(); err == nil {
+		username = current.Username
+	}
+
+	home, _ := os.UserHomeDir()
+
+	return Facts{
+		Hostname: hostname,
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		User:     username,
+		Home:     home,
+		Distro:   DetectDistro(),
+	}
+}
@@ -17,13 +17,18 @@ func Clone(url string, destDir string) error {
 	parts := strings.Split(url, "/")
 	repoName := strings.TrimSuffix(parts[len(parts)-1], ".git")
 
+	return CloneTo(url, filepath.Join(destDir, repoName))
+}
+
+// CloneTo clones a repository into path and tracks it under the path's name
+func CloneTo(url string, path string) error {
 	// Create destination directory if it doesn't exist
-	if err := os.MkdirAll(destDir, 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
 		return fmt.Errorf("failed to create destination directory: %w", err)
 	}
 
 	// Clone the repository
-	result, err := shell.Execute("git", "clone", url, filepath.Join(destDir, repoName))
+	result, err := shell.Execute("git", "clone", url, path)
 	if err != nil {
 		return fmt.Errorf("failed to clone repository: %w", err)
 	}
@@ -36,9 +41,12 @@ func Clone(url string, destDir string) error {
 		return fmt.Errorf("failed to get config: %w", err)
 	}
 
-	cfg.TrackedRepos[repoName] = config.Repository{
+	if cfg.TrackedRepos == nil {
+		cfg.TrackedRepos = make(map[string]config.Repository)
+	}
+	cfg.TrackedRepos[filepath.Base(path)] = config.Repository{
 		URL:         url,
-		Path:        filepath.Join(destDir, repoName),
+		Path:        path,
 		Description: "",
 		LastUpdated: time.Now().Format(time.RFC3339),
 	}
@@ -50,6 +58,24 @@ func Clone(url string, destDir string) error {
 	return nil
 }
 
+// Head returns the commit checked out in a repository and its branch, which
+// is "HEAD" when detached
+func Head(path string) (commit string, branch string, err error) {
+	result, err := shell.ExecuteInDir(path, "git", "rev-parse", "HEAD")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get commit of %s: %w", path, err)
+	}
+	commit = strings.TrimSpace(result.Stdout)
+
+	result, err = shell.ExecuteInDir(path, "git", "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get branch of %s: %w", path, err)
+	}
+	branch = strings.TrimSpace(result.Stdout)
+
+	return commit, branch, nil
+}
+
 // Update updates a tracked repository
 func Update(repoName string) error {
 	cfg, err := config.GetConfig()
@@ -71,6 +71,36 @@ func ExecuteInDir(dir, command string, args ...string) (*Result, error) {
 	return result, nil
 }
 
+// ExecuteWithEnv runs a shell command in the specified directory with extra
+// environment variables in KEY=value form and returns the result
+func ExecuteWithEnv(dir string, env []string, command string, args ...string) (*Result, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	result := &Result{
+		Command: fmt.Sprintf("%s %s", command, strings.Join(args, " ")),
+		Stdout:  stdout.String(),
+		Stderr:  stderr.String(),
+	}
+
+	if err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok {
+			result.ExitCode = exitError.ExitCode()
+		}
+		return result, fmt.Errorf("command failed: %w", err)
+	}
+
+	result.ExitCode = 0
+	return result, nil
+}
+
 // CommandExists checks if a command exists in the system
 func CommandExists(command string) bool {
 	_, err := exec.LookPath(command)
@@ -0,0 +1,324 @@
+package system
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/ui"
+)
+
+// archiveVars are the fields available to archive URL templates
+type archiveVars struct {
+	Name    string
+	Version string
+
+	// GOOS and GOARCH, such as "linux" and "amd64"
+	OS   string
+	Arch string
+
+	// Architecture as uname -m prints it, such as "x86_64" or "aarch64"
+	Machine string
+}
+
+// machines map GOARCH to the names release assets commonly use instead
+var machines = map[string]string{
+	"amd64": "x86_64",
+	"arm64": "aarch64",
+	"386":   "i386",
+	"arm":   "armv7",
+}
+
+// httpClient downloads release archives. The timeout keeps a stalled server
+// from hanging an install forever.
+var httpClient = &http.Client{Timeout: 10 * time.Minute}
+
+// UserBinDir returns the directory user-level installs put binaries in
+func UserBinDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".local", "bin"), nil
+}
+
+// archiveURL expands the archive URL template of a tool for this machine
+func archiveURL(tool config.ToolSpec) (string, error) {
+	if tool.Version == "" && strings.Contains(tool.Source, ".Version") {
+		return "", fmt.Errorf("archive URL of %s uses the version, but no version is pinned", tool.Name)
+	}
+
+	tmpl, err := template.New(tool.Name).Option("missingkey=error").Parse(tool.Source)
+	if err != nil {
+		return "", fmt.Errorf("invalid archive URL for %s: %w", tool.Name, err)
+	}
+
+	machine, ok := machines[runtime.GOARCH]
+	if !ok {
+		machine = runtime.GOARCH
+	}
+
+	var url strings.Builder
+	err = tmpl.Execute(&url, archiveVars{
+		Name:    tool.Name,
+		Version: strings.TrimPrefix(tool.Version, "v"),
+		OS:      runtime.GOOS,
+		Arch:    runtime.GOARCH,
+		Machine: machine,
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid archive URL for %s: %w", tool.Name, err)
+	}
+
+	return url.String(), nil
+}
+
+// installArchive downloads a tool's release archive, checks it against the
+// pinned SHA-256, unless the tool opts out with skip_checksum, and extracts
+// the tool's binaries into UserBinDir. Binaries already there that an earlier
+// install of the tool didn't write are never overwritten. Files from an
+// earlier install of another version that this one doesn't replace are
+// removed, and the install is recorded.
+func installArchive(tool config.ToolSpec) (InstallRecord, error) {
+	url, err := archiveURL(tool)
+	if err != nil {
+		return InstallRecord{}, err
+	}
+
+	binDir, err := UserBinDir()
+	if err != nil {
+		return InstallRecord{}, err
+	}
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return InstallRecord{}, fmt.Errorf("failed to create %s: %w", binDir, err)
+	}
+
+	archive, sum, err := Download(url)
+	if err != nil {
+		return InstallRecord{}, fmt.Errorf("failed to download %s: %w", url, err)
+	}
+	defer os.Remove(archive)
+
+	if expected := tool.Checksum(); expected == "" {
+		if !tool.SkipChecksum {
+			return InstallRecord{}, fmt.Errorf("no sha256 pinned for %s on %s/%s, pin the archive's sha256 %s or set skip_checksum", tool.Name, runtime.GOOS, runtime.GOARCH, sum)
+		}
+		ui.PrintWarning("Not verifying %s, skip_checksum is set and the archive has sha256 %s", url, sum)
+	} else if !strings.EqualFold(expected, sum) {
+		return InstallRecord{}, fmt.Errorf("checksum mismatch for %s: expected sha256 %s, got %s", url, expected, sum)
+	}
+
+	records, err := ReadRecords()
+	if err != nil {
+		return InstallRecord{}, err
+	}
+	previous := records[tool.Name]
+
+	// Extract next to the binaries first, so files milo didn't install are
+	// found before anything in binDir is replaced
+	staging, err := os.MkdirTemp(binDir, "."+tool.Name+"-*")
+	if err != nil {
+		return InstallRecord{}, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	extracted, err := ExtractBinaries(archive, url, tool.BinaryNames(), staging)
+	if err != nil {
+		return InstallRecord{}, fmt.Errorf("failed to extract %s: %w", url, err)
+	}
+
+	files := make([]string, len(extracted))
+	for i, path := range extracted {
+		files[i] = filepath.Join(binDir, filepath.Base(path))
+		if _, err := os.Lstat(files[i]); err == nil && !slices.Contains(previous.Files, files[i]) {
+			return InstallRecord{}, fmt.Errorf("refusing to overwrite %s, which milo didn't install", files[i])
+		}
+	}
+	for i, path := range extracted {
+		if err := os.Rename(path, files[i]); err != nil {
+			return InstallRecord{}, fmt.Errorf("failed to install %s: %w", files[i], err)
+		}
+	}
+
+	for _, file := range previous.Files {
+		if !slices.Contains(files, file) {
+			os.Remove(file)
+		}
+	}
+
+	record := InstallRecord{
+		Tool:        tool.Name,
+		Method:      config.MethodArchive,
+		Source:      url,
+		Version:     tool.Version,
+		SHA256:      sum,
+		Files:       files,
+		InstalledAt: time.Now(),
+	}
+	if err := saveRecord(record); err != nil {
+		return InstallRecord{}, err
+	}
+
+	return record, nil
+}
+
+// Download saves a URL or local path to a temporary file and returns the
+// file and its SHA-256. The caller removes the file.
+func Download(url string) (string, string, error) {
+	var reader io.Reader
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		response, err := httpClient.Get(url)
+		if err != nil {
+			return "", "", err
+		}
+		defer response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			return "", "", fmt.Errorf("download failed: %s", response.Status)
+		}
+		reader = response.Body
+	} else {
+		file, err := os.Open(url)
+		if err != nil {
+			return "", "", err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	temp, err := os.CreateTemp("", "milo-archive-*")
+	if err != nil {
+		return "", "", err
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(temp, hash), reader); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return "", "", err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return "", "", err
+	}
+
+	return temp.Name(), hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ExtractBinaries writes the files named like one of binaries from a .tar.gz
+// or .zip archive into dir and returns their paths. Any other download is
+// taken to be the binary itself. url is only used for its extension.
+func ExtractBinaries(archive, url string, binaries []string, dir string) ([]string, error) {
+	var files []string
+	extract := func(name string, reader io.Reader) error {
+		name = filepath.Base(name)
+		if !slices.Contains(binaries, name) || slices.Contains(files, filepath.Join(dir, name)) {
+			return nil
+		}
+		path := filepath.Join(dir, name)
+		if err := writeExecutable(path, reader); err != nil {
+			return err
+		}
+		files = append(files, path)
+		return nil
+	}
+
+	file, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	switch {
+	case strings.HasSuffix(url, ".tar.gz") || strings.HasSuffix(url, ".tgz"):
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, err
+		}
+		reader := tar.NewReader(gz)
+		for {
+			header, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if header.Typeflag == tar.TypeReg {
+				if err := extract(header.Name, reader); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+	case strings.HasSuffix(url, ".zip"):
+		info, err := file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		reader, err := zip.NewReader(file, info.Size())
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range reader.File {
+			if entry.FileInfo().IsDir() {
+				continue
+			}
+			content, err := entry.Open()
+			if err != nil {
+				return nil, err
+			}
+			err = extract(entry.Name, content)
+			content.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+	default:
+		if err := extract(binaries[0], file); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("none of %s found in the archive", strings.Join(binaries, ", "))
+	}
+	return files, nil
+}
+
+// writeExecutable writes an executable file, replacing it only once it is
+// complete so a failed write leaves the old file in place
+func writeExecutable(path string, reader io.Reader) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := io.Copy(temp, reader); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temp.Name(), 0755); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), path)
+}
@@ -0,0 +1,279 @@
+package system
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/logger"
+)
+
+func TestMain(m *testing.M) {
+	// The config reads the default tools relative to the repository root and
+	// keeps its files and the installed binaries under HOME
+	home, err := os.MkdirTemp("", "milo-archive-test-*")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	if err := os.Chdir(filepath.Join("..", "..")); err != nil {
+		panic(err)
+	}
+	logger.Init(logger.LevelInfo)
+
+	code := m.Run()
+	logger.Close()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+// serve serves each body at its path and returns the server's URL
+func serve(t *testing.T, bodies map[string][]byte) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := bodies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+	for name, content := range files {
+		header := &tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := archive.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := archive.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func zipped(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		writer, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sha(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func archiveTool(name, version, source string, checksum string) config.ToolSpec {
+	tool := config.ToolSpec{
+		Name:    name,
+		Version: version,
+		Method:  config.MethodArchive,
+		Source:  source,
+	}
+	if checksum != "" {
+		tool.Checksums = map[string]string{runtime.GOOS + "/" + runtime.GOARCH: checksum}
+	}
+	return tool
+}
+
+// binPath returns where a binary is installed
+func binPath(t *testing.T, name string) string {
+	t.Helper()
+	dir, err := UserBinDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, name)
+}
+
+func assertContent(t *testing.T, path, want string) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s: %v", path, err)
+	}
+	if string(got) != want {
+		t.Errorf("%s = %q, want %q", path, got, want)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0100 == 0 {
+		t.Errorf("%s is not executable: %v", path, info.Mode())
+	}
+}
+
+func TestInstallArchiveFormats(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		body func(t *testing.T, name string) []byte
+	}{
+		{"tar.gz", "release.tar.gz", func(t *testing.T, name string) []byte {
+			return tarGz(t, map[string]string{"release/" + name: "tar binary", "release/README": "docs"})
+		}},
+		{"zip", "release.zip", func(t *testing.T, name string) []byte {
+			return zipped(t, map[string]string{"release/" + name: "zip binary", "release/LICENSE": "license"})
+		}},
+		{"binary", "release", func(t *testing.T, name string) []byte {
+			return []byte("raw binary")
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := "format-" + strings.ReplaceAll(test.name, ".", "-")
+			body := test.body(t, name)
+			url := serve(t, map[string][]byte{"/" + test.file: body})
+
+			record, err := installArchive(archiveTool(name, "1.0.0", url+"/"+test.file, sha(body)))
+			if err != nil {
+				t.Fatalf("installArchive: %v", err)
+			}
+
+			path := binPath(t, name)
+			want := map[string]string{"tar.gz": "tar binary", "zip": "zip binary", "binary": "raw binary"}[test.name]
+			assertContent(t, path, want)
+
+			if len(record.Files) != 1 || record.Files[0] != path {
+				t.Errorf("Files = %v, want [%s]", record.Files, path)
+			}
+			if record.SHA256 != sha(body) {
+				t.Errorf("SHA256 = %s, want %s", record.SHA256, sha(body))
+			}
+		})
+	}
+}
+
+func TestInstallArchiveChecksumMismatch(t *testing.T) {
+	body := tarGz(t, map[string]string{"mismatch": "binary"})
+	url := serve(t, map[string][]byte{"/mismatch.tar.gz": body})
+
+	_, err := installArchive(archiveTool("mismatch", "1.0.0", url+"/mismatch.tar.gz", sha([]byte("something else"))))
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("installArchive error = %v, want a checksum mismatch", err)
+	}
+	if _, err := os.Stat(binPath(t, "mismatch")); !os.IsNotExist(err) {
+		t.Errorf("binary was installed despite the mismatch")
+	}
+}
+
+func TestInstallArchiveRequiresChecksum(t *testing.T) {
+	body := tarGz(t, map[string]string{"unpinned": "binary"})
+	url := serve(t, map[string][]byte{"/unpinned.tar.gz": body})
+
+	tool := archiveTool("unpinned", "1.0.0", url+"/unpinned.tar.gz", "")
+	if _, err := installArchive(tool); err == nil || !strings.Contains(err.Error(), "no sha256 pinned") {
+		t.Fatalf("installArchive error = %v, want a missing checksum", err)
+	}
+	if _, err := os.Stat(binPath(t, "unpinned")); !os.IsNotExist(err) {
+		t.Errorf("binary was installed without a checksum")
+	}
+
+	tool.SkipChecksum = true
+	if _, err := installArchive(tool); err != nil {
+		t.Fatalf("installArchive with skip_checksum: %v", err)
+	}
+	assertContent(t, binPath(t, "unpinned"), "binary")
+}
+
+func TestInstallArchiveRemovesStaleFiles(t *testing.T) {
+	v1 := tarGz(t, map[string]string{"stale": "v1", "stale-helper": "v1 helper"})
+	v2 := tarGz(t, map[string]string{"stale": "v2"})
+	url := serve(t, map[string][]byte{"/stale-1.0.0.tar.gz": v1, "/stale-2.0.0.tar.gz": v2})
+
+	tool := archiveTool("stale", "1.0.0", url+"/stale-{{.Version}}.tar.gz", sha(v1))
+	tool.Binaries = []string{"stale", "stale-helper"}
+	if _, err := installArchive(tool); err != nil {
+		t.Fatalf("installing 1.0.0: %v", err)
+	}
+	assertContent(t, binPath(t, "stale-helper"), "v1 helper")
+
+	tool.Version = "2.0.0"
+	tool.Checksums = map[string]string{runtime.GOOS + "/" + runtime.GOARCH: sha(v2)}
+	record, err := installArchive(tool)
+	if err != nil {
+		t.Fatalf("installing 2.0.0: %v", err)
+	}
+
+	assertContent(t, binPath(t, "stale"), "v2")
+	if _, err := os.Stat(binPath(t, "stale-helper")); !os.IsNotExist(err) {
+		t.Errorf("stale-helper from 1.0.0 was not removed")
+	}
+	if len(record.Files) != 1 {
+		t.Errorf("Files = %v, want only the v2 binary", record.Files)
+	}
+
+	records, err := ReadRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if records["stale"].Version != "2.0.0" {
+		t.Errorf("recorded version = %q, want 2.0.0", records["stale"].Version)
+	}
+}
+
+func TestInstallArchiveKeepsForeignBinaries(t *testing.T) {
+	path := binPath(t, "foreign")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("mine"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	body := tarGz(t, map[string]string{"foreign": "theirs"})
+	url := serve(t, map[string][]byte{"/foreign.tar.gz": body})
+
+	_, err := installArchive(archiveTool("foreign", "1.0.0", url+"/foreign.tar.gz", sha(body)))
+	if err == nil || !strings.Contains(err.Error(), "refusing to overwrite") {
+		t.Fatalf("installArchive error = %v, want a refusal to overwrite", err)
+	}
+	assertContent(t, path, "mine")
+
+	records, err := ReadRecords()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := records["foreign"]; ok {
+		t.Errorf("install over a foreign binary was recorded")
+	}
+}
@@ -0,0 +1,88 @@
+package system
+
+import (
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/shell"
+	"github.com/bayou-brogrammer/mygo/internal/ui"
+)
+
+// Outcomes of installing a tool
+const (
+	// OutcomeInstalled means milo installed the tool
+	OutcomeInstalled = "installed"
+
+	// OutcomeSkipped means the tool was already installed
+	OutcomeSkipped = "skipped"
+
+	// OutcomeFailed means installing the tool went wrong
+	OutcomeFailed = "failed"
+
+	// OutcomeUnsupported means none of the tool's install methods works here
+	OutcomeUnsupported = "unsupported"
+)
+
+// InstallResult is the outcome of installing one tool
+type InstallResult struct {
+	Tool config.ToolSpec
+
+	// One of the Outcome constants
+	Outcome string
+
+	// Install method that was run, empty when nothing was
+	Method string
+
+	// Why the tool failed or is unsupported
+	Err error
+
+	// Output of the install command
+	Output *shell.Result
+}
+
+// Failed reports whether the result fails the run. Optional tools never do.
+func (r InstallResult) Failed() bool {
+	return !r.Tool.Optional && (r.Outcome == OutcomeFailed || r.Outcome == OutcomeUnsupported)
+}
+
+// printSummary prints a table with the outcome of each tool
+func printSummary(results []InstallResult) {
+	if len(results) == 0 {
+		return
+	}
+
+	ui.PrintSubtitle("Summary")
+
+	width := 0
+	for _, result := range results {
+		width = max(width, len(result.Tool.Name))
+	}
+
+	for _, result := range results {
+		method := result.Method
+		if method == "" {
+			method = "-"
+		}
+
+		line := []any{width, result.Tool.Name, result.Outcome, method}
+		detail := ""
+		if result.Err != nil {
+			detail = result.Err.Error()
+		}
+		if result.Tool.Optional && result.Err != nil {
+			detail = "optional, " + detail
+		}
+		line = append(line, detail)
+
+		switch result.Outcome {
+		case OutcomeInstalled:
+			ui.PrintSuccess("%-*s  %-11s  %-7s  %s", line...)
+		case OutcomeSkipped:
+			ui.PrintInfo("%-*s  %-11s  %-7s  %s", line...)
+		default:
+			if result.Failed() {
+				ui.PrintError("%-*s  %-11s  %-7s  %s", line...)
+			} else {
+				ui.PrintWarning("%-*s  %-11s  %-7s  %s", line...)
+			}
+		}
+	}
+}
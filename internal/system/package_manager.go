@@ -0,0 +1,287 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/platform"
+	"github.com/bayou-brogrammer/mygo/internal/shell"
+)
+
+// PackageManager installs and updates system packages
+type PackageManager interface {
+	// Name of the package manager, such as "apt"
+	Name() string
+
+	// Install installs packages in one transaction
+	Install(pkgs ...string) (*shell.Result, error)
+
+	// Reinstall installs packages again even if they are installed
+	Reinstall(pkgs ...string) (*shell.Result, error)
+
+	// Remove uninstalls a package
+	Remove(pkg string) (*shell.Result, error)
+
+	// UpdateIndex refreshes the list of available packages
+	UpdateIndex() (*shell.Result, error)
+
+	// Upgrade upgrades every installed package
+	Upgrade() (*shell.Result, error)
+
+	// IsInstalled reports whether a package is installed
+	IsInstalled(pkg string) bool
+
+	// Version returns the version of the package manager itself
+	Version() (string, error)
+
+	// NeedsRoot reports whether installing packages needs root
+	NeedsRoot() bool
+}
+
+// commandManager is a package manager driven by its command line
+type commandManager struct {
+	name string
+
+	// Whether changes need root
+	root bool
+
+	install     []string
+	reinstall   []string
+	remove      []string
+	updateIndex []string
+	upgrade     []string
+
+	// Command that succeeds when a package is installed, with the package
+	// appended, and the output it has to print if set
+	query      []string
+	queryMatch string
+
+	version []string
+}
+
+// packageManagers are the supported package managers by name
+var packageManagers = map[string]*commandManager{
+	"apt": {
+		name:        "apt",
+		root:        true,
+		install:     []string{"apt-get", "install", "-y"},
+		reinstall:   []string{"apt-get", "install", "--reinstall", "-y"},
+		remove:      []string{"apt-get", "remove", "-y"},
+		updateIndex: []string{"apt-get", "update"},
+		upgrade:     []string{"apt-get", "upgrade", "-y"},
+		query:       []string{"dpkg-query", "-W", "-f=${db:Status-Status}"},
+		queryMatch:  "installed",
+		version:     []string{"apt-get", "--version"},
+	},
+	"dnf": {
+		name:        "dnf",
+		root:        true,
+		install:     []string{"dnf", "install", "-y"},
+		reinstall:   []string{"dnf", "reinstall", "-y"},
+		remove:      []string{"dnf", "remove", "-y"},
+		updateIndex: []string{"dnf", "makecache"},
+		upgrade:     []string{"dnf", "upgrade", "-y"},
+		query:       []string{"rpm", "-q"},
+		version:     []string{"dnf", "--version"},
+	},
+	"pacman": {
+		name:        "pacman",
+		root:        true,
+		install:     []string{"pacman", "-S", "--needed", "--noconfirm"},
+		reinstall:   []string{"pacman", "-S", "--noconfirm"},
+		remove:      []string{"pacman", "-R", "--noconfirm"},
+		updateIndex: []string{"pacman", "-Sy"},
+		upgrade:     []string{"pacman", "-Syu", "--noconfirm"},
+		query:       []string{"pacman", "-Q"},
+		version:     []string{"pacman", "-V"},
+	},
+	"zypper": {
+		name:        "zypper",
+		root:        true,
+		install:     []string{"zypper", "--non-interactive", "install"},
+		reinstall:   []string{"zypper", "--non-interactive", "install", "--force"},
+		remove:      []string{"zypper", "--non-interactive", "remove"},
+		updateIndex: []string{"zypper", "--non-interactive", "refresh"},
+		upgrade:     []string{"zypper", "--non-interactive", "update"},
+		query:       []string{"rpm", "-q"},
+		version:     []string{"zypper", "--version"},
+	},
+	"apk": {
+		name:        "apk",
+		root:        true,
+		install:     []string{"apk", "add"},
+		reinstall:   []string{"apk", "fix"},
+		remove:      []string{"apk", "del"},
+		updateIndex: []string{"apk", "update"},
+		upgrade:     []string{"apk", "upgrade"},
+		query:       []string{"apk", "info", "-e"},
+		version:     []string{"apk", "--version"},
+	},
+	"brew": {
+		name:        "brew",
+		install:     []string{"brew", "install"},
+		reinstall:   []string{"brew", "reinstall"},
+		remove:      []string{"brew", "uninstall"},
+		updateIndex: []string{"brew", "update"},
+		upgrade:     []string{"brew", "upgrade"},
+		query:       []string{"brew", "list", "--versions"},
+		version:     []string{"brew", "--version"},
+	},
+}
+
+// distroManagers map distributions to their package manager, checked in order
+var distroManagers = []struct {
+	distro  string
+	manager string
+}{
+	{"debian", "apt"},
+	{"ubuntu", "apt"},
+	{"fedora", "dnf"},
+	{"rhel", "dnf"},
+	{"centos", "dnf"},
+	{"arch", "pacman"},
+	{"opensuse", "zypper"},
+	{"suse", "zypper"},
+	{"alpine", "apk"},
+}
+
+func (m *commandManager) Name() string {
+	return m.name
+}
+
+func (m *commandManager) NeedsRoot() bool {
+	return m.root
+}
+
+func (m *commandManager) Install(pkgs ...string) (*shell.Result, error) {
+	return m.run(m.install, pkgs...)
+}
+
+func (m *commandManager) Reinstall(pkgs ...string) (*shell.Result, error) {
+	return m.run(m.reinstall, pkgs...)
+}
+
+func (m *commandManager) Remove(pkg string) (*shell.Result, error) {
+	return m.run(m.remove, pkg)
+}
+
+func (m *commandManager) UpdateIndex() (*shell.Result, error) {
+	return m.run(m.updateIndex)
+}
+
+func (m *commandManager) Upgrade() (*shell.Result, error) {
+	return m.run(m.upgrade)
+}
+
+func (m *commandManager) IsInstalled(pkg string) bool {
+	args := append(append([]string{}, m.query[1:]...), pkg)
+	result, err := shell.Execute(m.query[0], args...)
+	if err != nil {
+		return false
+	}
+	return m.queryMatch == "" || strings.TrimSpace(result.Stdout) == m.queryMatch
+}
+
+func (m *commandManager) Version() (string, error) {
+	result, err := shell.Execute(m.version[0], m.version[1:]...)
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s version: %w", m.name, err)
+	}
+
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line, nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to get %s version: no output", m.name)
+}
+
+// command builds the command line for an operation, adding sudo when the
+// package manager needs root and milo isn't running as root. sudo never asks
+// for a password, so milo can't hang on a prompt.
+func (m *commandManager) command(args []string, pkgs ...string) []string {
+	command := append(append([]string{}, args...), pkgs...)
+	if m.root && os.Geteuid() != 0 {
+		command = append([]string{"sudo", "-n"}, command...)
+	}
+	return command
+}
+
+// run executes an operation, failing early when it needs root milo can't get
+func (m *commandManager) run(args []string, pkgs ...string) (*shell.Result, error) {
+	if privileges := DetectPrivileges(); m.root && !privileges.CanRunAsRoot() {
+		return nil, privileges.rootError(m.name)
+	}
+
+	command := m.command(args, pkgs...)
+	return shell.Execute(command[0], command[1:]...)
+}
+
+// DetectPackageManager returns the package manager for this machine. The
+// package_manager config setting takes precedence. Otherwise macOS uses brew
+// and Linux distributions are matched by /etc/os-release, falling back to the
+// first supported package manager found on PATH.
+func DetectPackageManager() (PackageManager, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get config: %w", err)
+	}
+
+	name := cfg.PackageManager
+	if name == "" {
+		name, err = detectPackageManager(runtime.GOOS, platform.DetectDistro())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	manager, ok := packageManagers[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported package manager: %s", name)
+	}
+
+	// Check if package manager is installed
+	if !shell.CommandExists(manager.install[0]) {
+		if name == "brew" {
+			return nil, fmt.Errorf("%s is not installed, please install Homebrew first: https://brew.sh", name)
+		}
+		return nil, fmt.Errorf("%s is not installed, please install it first", name)
+	}
+
+	return manager, nil
+}
+
+// detectPackageManager picks the package manager name for an OS and distro
+func detectPackageManager(goos string, distro platform.Distro) (string, error) {
+	switch goos {
+	case "darwin":
+		return "brew", nil
+	case "linux":
+	default:
+		return "", fmt.Errorf("unsupported platform: %s - only darwin (macOS) and linux are supported", goos)
+	}
+
+	// Match the distribution itself before the ones it derives from
+	for _, entry := range distroManagers {
+		if distro.ID == entry.distro {
+			return entry.manager, nil
+		}
+	}
+	for _, entry := range distroManagers {
+		if distro.Is(entry.distro) {
+			return entry.manager, nil
+		}
+	}
+
+	for _, name := range []string{"apt", "dnf", "pacman", "zypper", "apk", "brew"} {
+		if shell.CommandExists(packageManagers[name].install[0]) {
+			return name, nil
+		}
+	}
+
+	return "", fmt.Errorf("no supported package manager found, set package_manager in the config")
+}
@@ -0,0 +1,71 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/bayou-brogrammer/mygo/internal/shell"
+)
+
+// Privileges describes whether milo can make system-wide changes
+type Privileges struct {
+	// Whether milo runs as root
+	Root bool
+
+	// Whether sudo works without asking for a password
+	Sudo bool
+
+	// Why sudo can't be used, when it can't
+	SudoReason string
+}
+
+var (
+	privileges     Privileges
+	privilegesOnce sync.Once
+)
+
+// DetectPrivileges checks whether milo runs as root and whether sudo works
+// non-interactively. The result is cached, because sudo -n is slow when it
+// fails over the network.
+func DetectPrivileges() Privileges {
+	privilegesOnce.Do(func() {
+		privileges.Root = os.Geteuid() == 0
+		if privileges.Root {
+			return
+		}
+
+		if !shell.CommandExists("sudo") {
+			privileges.SudoReason = "sudo is not installed"
+			return
+		}
+		if _, err := shell.Execute("sudo", "-n", "true"); err != nil {
+			privileges.SudoReason = "sudo needs a password ('sudo -n true' failed)"
+			return
+		}
+		privileges.Sudo = true
+	})
+	return privileges
+}
+
+// CanRunAsRoot reports whether milo can run commands as root
+func (p Privileges) CanRunAsRoot() bool {
+	return p.Root || p.Sudo
+}
+
+// rootError explains why a command that needs root can't run
+func (p Privileges) rootError(what string) error {
+	return fmt.Errorf("%s needs root, but milo isn't running as root and %s", what, p.SudoReason)
+}
+
+// String describes the privileges for the user
+func (p Privileges) String() string {
+	switch {
+	case p.Root:
+		return "root"
+	case p.Sudo:
+		return "sudo"
+	default:
+		return "user only, " + p.SudoReason
+	}
+}
@@ -0,0 +1,158 @@
+package system
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// RecordsFile is where milo records the tools it installed, in the config directory
+const RecordsFile = "installed.yaml"
+
+// InstallRecord describes a tool milo installed
+type InstallRecord struct {
+	Tool string `yaml:"tool"`
+
+	// Install method, one of config.Methods
+	Method string `yaml:"method"`
+
+	// Package manager of package installs, such as "apt"
+	Manager string `yaml:"manager,omitempty"`
+
+	// Package, module, crate or pipx package the tool was installed from
+	Package string `yaml:"package,omitempty"`
+
+	// Archive URL or script the tool was installed from
+	Source string `yaml:"source,omitempty"`
+
+	Version string `yaml:"version,omitempty"`
+
+	// SHA-256 of the downloaded archive
+	SHA256 string `yaml:"sha256,omitempty"`
+
+	// Files milo wrote that weren't there before, removed again on uninstall
+	// of archive, go and script installs
+	Files []string `yaml:"files,omitempty"`
+
+	InstalledAt time.Time `yaml:"installed_at"`
+}
+
+// recordsPath returns the path of the records file
+func recordsPath() (string, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return "", fmt.Errorf("failed to get configuration: %w", err)
+	}
+	return filepath.Join(cfg.ConfigDir, RecordsFile), nil
+}
+
+// ReadRecords returns the tools milo installed, by name
+func ReadRecords() (map[string]InstallRecord, error) {
+	path, err := recordsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	records := map[string]InstallRecord{}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read install records: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse install records: %w", err)
+	}
+	return records, nil
+}
+
+// recordsMu serializes changes to the records file by parallel installs
+var recordsMu sync.Mutex
+
+// saveRecord stores the record of an install, replacing an earlier one
+func saveRecord(record InstallRecord) error {
+	recordsMu.Lock()
+	defer recordsMu.Unlock()
+
+	records, err := ReadRecords()
+	if err != nil {
+		return err
+	}
+	records[record.Tool] = record
+	return writeRecords(records)
+}
+
+// deleteRecord forgets the install of a tool
+func deleteRecord(tool string) error {
+	recordsMu.Lock()
+	defer recordsMu.Unlock()
+
+	records, err := ReadRecords()
+	if err != nil {
+		return err
+	}
+	delete(records, tool)
+	return writeRecords(records)
+}
+
+// recordInstall stores where a job installed its tool from. Archive installs
+// record themselves, because only they know the files they wrote.
+func recordInstall(job *installJob) error {
+	chosen := job.chosen
+	record := InstallRecord{
+		Tool:        chosen.Name,
+		Method:      chosen.InstallMethod(),
+		Version:     chosen.Version,
+		InstalledAt: time.Now(),
+	}
+
+	switch record.Method {
+	case config.MethodArchive:
+		return nil
+	case config.MethodPackage:
+		record.Manager = job.command.name
+		record.Package, _ = chosen.Package(job.command.name)
+	case config.MethodScript:
+		record.Source = chosen.Source
+	default:
+		record.Package = chosen.Source
+	}
+
+	if version, err := ProbeVersion(chosen); err == nil {
+		record.Version = version
+	}
+
+	// Only the binary is known for other installers, and only when the
+	// install put it somewhere new
+	if record.Method != config.MethodPackage {
+		if path, found := toolBinary(chosen); found && path != job.existing {
+			record.Files = []string{path}
+		}
+	}
+
+	return saveRecord(record)
+}
+
+// writeRecords replaces the records file
+func writeRecords(records map[string]InstallRecord) error {
+	path, err := recordsPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to encode install records: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write install records: %w", err)
+	}
+	return nil
+}
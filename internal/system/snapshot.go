@@ -0,0 +1,564 @@
+package system
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/platform"
+	"github.com/bayou-brogrammer/mygo/internal/repo"
+	"github.com/bayou-brogrammer/mygo/internal/shell"
+	"github.com/bayou-brogrammer/mygo/internal/ui"
+	"gopkg.in/yaml.v3"
+)
+
+// LockfileVersion is the format version of the lockfiles milo writes
+const LockfileVersion = 1
+
+// DefaultLockfile is the lockfile snapshot writes without a path
+const DefaultLockfile = "milo.lock"
+
+// Lockfile records the state of a machine so another one can be brought to it
+type Lockfile struct {
+	Version   int       `yaml:"version"`
+	CreatedAt time.Time `yaml:"created_at"`
+	Host      string    `yaml:"host,omitempty"`
+
+	// GOOS and GOARCH
+	OS   string `yaml:"os"`
+	Arch string `yaml:"arch"`
+
+	Distro LockedDistro `yaml:"distro,omitempty"`
+
+	PackageManager        string `yaml:"package_manager,omitempty"`
+	PackageManagerVersion string `yaml:"package_manager_version,omitempty"`
+
+	Tools []LockedTool `yaml:"tools"`
+	Repos []LockedRepo `yaml:"repos,omitempty"`
+}
+
+// LockedDistro is the Linux distribution of a locked machine
+type LockedDistro struct {
+	ID         string `yaml:"id,omitempty"`
+	VersionID  string `yaml:"version_id,omitempty"`
+	PrettyName string `yaml:"pretty_name,omitempty"`
+}
+
+// LockedTool is an installed tool. The install fields are empty for tools
+// milo didn't install.
+type LockedTool struct {
+	Name    string `yaml:"name"`
+	Version string `yaml:"version,omitempty"`
+	Method  string `yaml:"method,omitempty"`
+	Manager string `yaml:"manager,omitempty"`
+	Package string `yaml:"package,omitempty"`
+	Source  string `yaml:"source,omitempty"`
+
+	// SHA-256 of the archive a release archive install downloaded
+	SHA256 string `yaml:"sha256,omitempty"`
+}
+
+// LockedRepo is a tracked repository at a commit
+type LockedRepo struct {
+	Name string `yaml:"name"`
+	URL  string `yaml:"url"`
+
+	// Path of the clone, starting with ~/ when inside the home directory
+	Path string `yaml:"path"`
+
+	Commit string `yaml:"commit"`
+	Branch string `yaml:"branch,omitempty"`
+}
+
+// SnapshotOptions defines options for taking a snapshot
+type SnapshotOptions struct {
+	// Enable verbose output
+	Verbose bool
+}
+
+// RestoreOptions defines options for restoring a snapshot
+type RestoreOptions struct {
+	// Show what would change without changing anything
+	DryRun bool
+
+	// Enable verbose output
+	Verbose bool
+}
+
+// CaptureLockfile captures the tools, package manager, OS, distribution and
+// tracked repositories of this machine
+func CaptureLockfile() (*Lockfile, error) {
+	lock := &Lockfile{
+		Version:   LockfileVersion,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+	lock.Host, _ = os.Hostname()
+
+	distro := platform.DetectDistro()
+	lock.Distro = LockedDistro{ID: distro.ID, VersionID: distro.VersionID, PrettyName: distro.PrettyName}
+
+	if pkgManager, err := DetectPackageManager(); err == nil {
+		lock.PackageManager = pkgManager.Name()
+		lock.PackageManagerVersion, _ = pkgManager.Version()
+	}
+
+	sources, err := Sources()
+	if err != nil {
+		return nil, err
+	}
+	for _, source := range sources {
+		if source.Path == "" {
+			continue
+		}
+		tool := LockedTool{Name: source.Tool, Version: source.Version}
+		if record := source.Record; record != nil {
+			tool.Method = record.Method
+			tool.Manager = record.Manager
+			tool.Package = record.Package
+			tool.Source = record.Source
+			tool.SHA256 = record.SHA256
+		}
+		lock.Tools = append(lock.Tools, tool)
+	}
+
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get configuration: %w", err)
+	}
+	for name, tracked := range cfg.TrackedRepos {
+		commit, branch, err := repo.Head(tracked.Path)
+		if err != nil {
+			ui.PrintWarning("Skipping repository %s: %v", name, err)
+			continue
+		}
+		lock.Repos = append(lock.Repos, LockedRepo{
+			Name:   name,
+			URL:    tracked.URL,
+			Path:   homeRelative(tracked.Path),
+			Commit: commit,
+			Branch: branch,
+		})
+	}
+	sort.Slice(lock.Repos, func(i, j int) bool {
+		return lock.Repos[i].Name < lock.Repos[j].Name
+	})
+
+	return lock, nil
+}
+
+// Snapshot writes a snapshot of this machine to a lockfile
+func Snapshot(path string) error {
+	return SnapshotWithOptions(path, SnapshotOptions{})
+}
+
+// SnapshotWithOptions writes a snapshot of this machine to a lockfile
+func SnapshotWithOptions(path string, options SnapshotOptions) error {
+	lock, err := CaptureLockfile()
+	if err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(lock)
+	if err != nil {
+		return fmt.Errorf("failed to encode lockfile: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write lockfile: %w", err)
+	}
+
+	if options.Verbose {
+		ui.PrintBox(string(data))
+	}
+	ui.PrintSuccess("Saved %d tools and %d repositories to %s", len(lock.Tools), len(lock.Repos), path)
+	return nil
+}
+
+// ReadLockfile reads a lockfile written by snapshot
+func ReadLockfile(path string) (*Lockfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockfile: %w", err)
+	}
+
+	var lock Lockfile
+	if err := yaml.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile %s: %w", path, err)
+	}
+	if lock.Version > LockfileVersion {
+		return nil, fmt.Errorf("lockfile %s has version %d, this milo reads up to %d", path, lock.Version, LockfileVersion)
+	}
+
+	return &lock, nil
+}
+
+// Restore brings this machine as close as it can to a lockfile
+func Restore(path string) error {
+	return RestoreWithOptions(path, RestoreOptions{})
+}
+
+// RestoreWithOptions brings this machine as close as it can to a lockfile. It
+// installs missing tools and archives at other versions, clones missing
+// repositories at their locked commit and reports what still differs. Existing
+// repositories are never moved to another commit.
+func RestoreWithOptions(path string, options RestoreOptions) error {
+	lock, err := ReadLockfile(path)
+	if err != nil {
+		return err
+	}
+
+	current, err := CaptureLockfile()
+	if err != nil {
+		return err
+	}
+
+	ui.PrintTitle("Restoring " + path)
+
+	if lock.OS != current.OS || lock.Arch != current.Arch {
+		ui.PrintWarning("Lockfile is for %s/%s, this machine is %s/%s", lock.OS, lock.Arch, current.OS, current.Arch)
+	}
+	if lock.PackageManager != current.PackageManager {
+		ui.PrintWarning("Lockfile used %s, this machine uses %s", lock.PackageManager, current.PackageManager)
+	}
+
+	installed := make(map[string]LockedTool)
+	for _, tool := range current.Tools {
+		installed[tool.Name] = tool
+	}
+
+	var specs []config.ToolSpec
+	for _, locked := range lock.Tools {
+		tool, ok := installed[locked.Name]
+		if ok && (tool.Version == locked.Version || locked.Method != config.MethodArchive) {
+			continue
+		}
+		specs = append(specs, lockedSpec(locked, lock.OS+"/"+lock.Arch, current.PackageManager))
+	}
+
+	// Failed tools don't stop the repositories from being restored, but make
+	// the restore fail in the end
+	toolsErr := restoreTools(specs, options)
+	reposErr := restoreRepos(lock.Repos, options)
+
+	if options.DryRun {
+		return errors.Join(toolsErr, reposErr)
+	}
+
+	// Compare again to show what couldn't be restored
+	current, err = CaptureLockfile()
+	if err != nil {
+		return err
+	}
+	differences := DiffLockfiles(lock, current, path, "this machine")
+	if len(differences) == 0 {
+		ui.PrintSuccess("This machine matches %s", path)
+		return errors.Join(toolsErr, reposErr)
+	}
+
+	ui.PrintSubtitle("Remaining differences")
+	for _, difference := range differences {
+		ui.PrintWarning("%s", difference)
+	}
+	return errors.Join(toolsErr, reposErr)
+}
+
+// lockedSpec returns the spec that installs a locked tool. The configured
+// spec is used when there is one, otherwise the lockfile's install record.
+// Archives are pinned to the checksum locked for the lockfile's GOOS/GOARCH.
+func lockedSpec(locked LockedTool, lockPlatform, manager string) config.ToolSpec {
+	// The locked archive is only accepted with the checksum it had
+	var checksums map[string]string
+	if locked.SHA256 != "" {
+		checksums = map[string]string{lockPlatform: locked.SHA256}
+	}
+
+	cfg, err := config.GetConfig()
+	if err == nil {
+		if spec, ok := cfg.FindTool(locked.Name); ok {
+			tool := ResolveTool(spec)
+			if tool.InstallMethod() == config.MethodArchive {
+				tool.Version = locked.Version
+				if checksums != nil {
+					tool.Checksums = checksums
+				}
+			}
+			return tool
+		}
+	}
+
+	tool := LookupTool(locked.Name)
+	switch locked.Method {
+	case config.MethodPackage:
+		if locked.Manager == manager {
+			tool.Packages = map[string]string{manager: locked.Package}
+		}
+	case config.MethodArchive:
+		// The URL is already expanded, so it only fits the same platform
+		tool.Method = config.MethodArchive
+		tool.Source = locked.Source
+		tool.Version = locked.Version
+		tool.Checksums = checksums
+	case config.MethodGo, config.MethodCargo, config.MethodPipx:
+		tool.Method = locked.Method
+		tool.Source = locked.Package
+	case config.MethodScript:
+		tool.Method = locked.Method
+		tool.Source = locked.Source
+	}
+	return tool
+}
+
+// restoreTools installs the tools a lockfile has and this machine doesn't
+func restoreTools(specs []config.ToolSpec, options RestoreOptions) error {
+	if len(specs) == 0 {
+		ui.PrintInfo("All locked tools are installed")
+		return nil
+	}
+
+	if options.DryRun {
+		for _, spec := range specs {
+			ui.PrintInfo("Would install %s with %s", spec.Name, spec.InstallMethod())
+		}
+		return nil
+	}
+
+	pkgManager, err := DetectPackageManager()
+	if err != nil {
+		return err
+	}
+
+	results := InstallTools(specs, pkgManager, InstallOptions{SkipExisting: true, Verbose: options.Verbose})
+	printSummary(results)
+
+	failed := 0
+	for _, result := range results {
+		if result.Failed() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d locked tools failed to install", failed, len(results))
+	}
+	return nil
+}
+
+// restoreRepos clones the repositories a lockfile has and this machine
+// doesn't, and checks them out at their locked commit. A failed repository
+// doesn't stop the others; the failures are returned together.
+func restoreRepos(repos []LockedRepo, options RestoreOptions) error {
+	var errs []error
+	for _, locked := range repos {
+		path, err := expandHome(locked.Path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore %s: %w", locked.Name, err))
+			continue
+		}
+
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+
+		ui.PrintInfo("Cloning %s into %s at %s", locked.URL, path, shortCommit(locked.Commit))
+		if options.DryRun {
+			continue
+		}
+
+		if err := repo.CloneTo(locked.URL, path); err != nil {
+			ui.PrintError("Failed to clone %s: %v", locked.Name, err)
+			errs = append(errs, fmt.Errorf("failed to clone %s: %w", locked.Name, err))
+			continue
+		}
+
+		commit, _, err := repo.Head(path)
+		if err == nil && commit != locked.Commit {
+			if result, err := shell.ExecuteInDir(path, "git", "checkout", "-q", locked.Commit); err != nil {
+				err = withStderr(result, err)
+				ui.PrintError("Failed to check out %s in %s: %v", shortCommit(locked.Commit), locked.Name, err)
+				errs = append(errs, fmt.Errorf("failed to check out %s in %s: %w", shortCommit(locked.Commit), locked.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DiffLockfiles explains how two lockfiles differ, one line per difference.
+// The names label the lockfiles in the lines.
+func DiffLockfiles(a, b *Lockfile, nameA, nameB string) []string {
+	var differences []string
+	differ := func(what, valueA, valueB string) {
+		if valueA != valueB {
+			differences = append(differences, fmt.Sprintf("%s: %s in %s, %s in %s", what, orNone(valueA), nameA, orNone(valueB), nameB))
+		}
+	}
+
+	differ("platform", a.OS+"/"+a.Arch, b.OS+"/"+b.Arch)
+	differ("distribution", distroName(a.Distro), distroName(b.Distro))
+	differ("package manager", a.PackageManager, b.PackageManager)
+
+	toolsA := make(map[string]LockedTool)
+	for _, tool := range a.Tools {
+		toolsA[tool.Name] = tool
+	}
+	toolsB := make(map[string]LockedTool)
+	for _, tool := range b.Tools {
+		toolsB[tool.Name] = tool
+	}
+	for _, name := range unionKeys(toolsA, toolsB) {
+		toolA, inA := toolsA[name]
+		toolB, inB := toolsB[name]
+		switch {
+		case !inB:
+			differences = append(differences, fmt.Sprintf("tool %s: only in %s (%s)", name, nameA, orNone(toolA.Version)))
+		case !inA:
+			differences = append(differences, fmt.Sprintf("tool %s: only in %s (%s)", name, nameB, orNone(toolB.Version)))
+		default:
+			differ("tool "+name+" version", toolA.Version, toolB.Version)
+			differ("tool "+name+" source", toolA.describe(), toolB.describe())
+		}
+	}
+
+	reposA := make(map[string]LockedRepo)
+	for _, locked := range a.Repos {
+		reposA[locked.Name] = locked
+	}
+	reposB := make(map[string]LockedRepo)
+	for _, locked := range b.Repos {
+		reposB[locked.Name] = locked
+	}
+	for _, name := range unionKeys(reposA, reposB) {
+		repoA, inA := reposA[name]
+		repoB, inB := reposB[name]
+		switch {
+		case !inB:
+			differences = append(differences, fmt.Sprintf("repo %s: only in %s (%s)", name, nameA, shortCommit(repoA.Commit)))
+		case !inA:
+			differences = append(differences, fmt.Sprintf("repo %s: only in %s (%s)", name, nameB, shortCommit(repoB.Commit)))
+		default:
+			differ("repo "+name+" url", repoA.URL, repoB.URL)
+			differ("repo "+name+" path", repoA.Path, repoB.Path)
+			differ("repo "+name+" commit", shortCommit(repoA.Commit), shortCommit(repoB.Commit))
+			differ("repo "+name+" branch", repoA.Branch, repoB.Branch)
+		}
+	}
+
+	return differences
+}
+
+// Diff prints how two lockfiles differ. Without a second path the first
+// lockfile is compared with this machine.
+func Diff(pathA, pathB string) error {
+	a, err := ReadLockfile(pathA)
+	if err != nil {
+		return err
+	}
+
+	var b *Lockfile
+	nameB := pathB
+	if pathB == "" {
+		nameB = "this machine"
+		b, err = CaptureLockfile()
+	} else {
+		b, err = ReadLockfile(pathB)
+	}
+	if err != nil {
+		return err
+	}
+
+	differences := DiffLockfiles(a, b, pathA, nameB)
+	if len(differences) == 0 {
+		ui.PrintSuccess("%s and %s match", pathA, nameB)
+		return nil
+	}
+
+	ui.PrintTitle(fmt.Sprintf("%d differences", len(differences)))
+	for _, difference := range differences {
+		ui.PrintInfo("%s", difference)
+	}
+	return nil
+}
+
+// describe returns where the tool came from
+func (t LockedTool) describe() string {
+	switch t.Method {
+	case "":
+		return "not installed by milo"
+	case config.MethodPackage:
+		return fmt.Sprintf("%s package %s", t.Manager, t.Package)
+	case config.MethodArchive, config.MethodScript:
+		return fmt.Sprintf("%s %s", t.Method, t.Source)
+	default:
+		return fmt.Sprintf("%s %s", t.Method, t.Package)
+	}
+}
+
+// distroName returns the name of a distribution for the user
+func distroName(distro LockedDistro) string {
+	if distro.PrettyName != "" {
+		return distro.PrettyName
+	}
+	return strings.TrimSpace(distro.ID + " " + distro.VersionID)
+}
+
+// unionKeys returns the keys of two maps, sorted
+func unionKeys[V any](a, b map[string]V) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// orNone shows empty values as "none"
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+// shortCommit abbreviates a commit SHA
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
+
+// homeRelative writes paths inside the home directory with ~/, so they fit
+// machines with another home directory
+func homeRelative(path string) string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(homeDir, path); err == nil && !strings.HasPrefix(rel, "..") && rel != "." {
+		return "~/" + filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// expandHome turns a path starting with ~/ into an absolute path
+func expandHome(path string) (string, error) {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, filepath.FromSlash(rest)), nil
+}
@@ -0,0 +1,46 @@
+package system
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRestoreReposReportsFailures(t *testing.T) {
+	origin := filepath.Join(t.TempDir(), "origin")
+	for _, args := range [][]string{
+		{"init", "-q", origin},
+		{"-C", origin, "-c", "user.name=milo", "-c", "user.email=milo@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+	} {
+		if out, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+
+	dir := t.TempDir()
+	repos := []LockedRepo{
+		{Name: "missing", URL: filepath.Join(dir, "does-not-exist"), Path: filepath.Join(dir, "missing"), Commit: "0123456789abcdef0123456789abcdef01234567"},
+		{Name: "moved", URL: origin, Path: filepath.Join(dir, "moved"), Commit: "0123456789abcdef0123456789abcdef01234567"},
+	}
+
+	err := restoreRepos(repos, RestoreOptions{})
+	if err == nil {
+		t.Fatal("restoreRepos succeeded, want the clone and checkout failures")
+	}
+	for _, want := range []string{"failed to clone missing", "failed to check out 0123456789ab in moved"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("restoreRepos error = %v, want %q", err, want)
+		}
+	}
+
+	// The failed clone doesn't stop the next repository
+	if _, err := os.Stat(filepath.Join(dir, "moved", ".git")); err != nil {
+		t.Errorf("moved was not cloned: %v", err)
+	}
+
+	if err := restoreRepos(repos[1:], RestoreOptions{DryRun: true}); err != nil {
+		t.Errorf("restoreRepos of an existing clone = %v, want nil", err)
+	}
+}
@@ -0,0 +1,170 @@
+package system
+
+import (
+	"fmt"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/ui"
+)
+
+// Results of checking a tool against its spec
+const (
+	// CheckOK means the tool is installed and meets its version requirements
+	CheckOK = "ok"
+
+	// CheckMissing means none of the tool's binaries is on PATH
+	CheckMissing = "missing"
+
+	// CheckTooOld means the tool is older than its minimum or pinned version
+	CheckTooOld = "too old"
+
+	// CheckNewer means the tool is newer than its pinned version
+	CheckNewer = "newer than pinned"
+
+	// CheckUnknown means the tool is installed but its version can't be read
+	CheckUnknown = "unknown version"
+)
+
+// CheckOptions defines options for checking tools
+type CheckOptions struct {
+	// Only check configured tools with one of these tags, all when empty
+	Tags []string
+
+	// Enable verbose output
+	Verbose bool
+}
+
+// ToolCheck is the result of checking one tool
+type ToolCheck struct {
+	Tool config.ToolSpec
+
+	// One of the Check constants
+	Status string
+
+	// Installed version, empty when missing or unknown
+	Version string
+
+	// Why the version couldn't be read
+	Err error
+}
+
+// Failed reports whether the tool doesn't meet its requirements. Optional
+// tools never fail, and an unreadable version only fails when one is required.
+func (c ToolCheck) Failed() bool {
+	if c.Tool.Optional {
+		return false
+	}
+	switch c.Status {
+	case CheckMissing, CheckTooOld:
+		return true
+	case CheckUnknown:
+		return c.Tool.MinVersion != "" || c.Tool.Version != ""
+	}
+	return false
+}
+
+// CheckTool checks that a tool is installed and meets its version requirements
+func CheckTool(spec config.ToolSpec) ToolCheck {
+	tool := ResolveTool(spec)
+	check := ToolCheck{Tool: tool}
+
+	if _, found := toolBinary(tool); !found {
+		check.Status = CheckMissing
+		return check
+	}
+
+	version, err := ProbeVersion(tool)
+	if err != nil {
+		check.Status = CheckUnknown
+		check.Err = err
+		return check
+	}
+	check.Version = version
+
+	switch {
+	case tool.MinVersion != "" && CompareVersions(version, tool.MinVersion) < 0:
+		check.Status = CheckTooOld
+	case tool.Version != "" && CompareVersions(version, tool.Version) < 0:
+		check.Status = CheckTooOld
+	case tool.Version != "" && CompareVersions(version, tool.Version) > 0:
+		check.Status = CheckNewer
+	default:
+		check.Status = CheckOK
+	}
+
+	return check
+}
+
+// Check checks the tools from the configuration
+func Check() error {
+	return CheckWithOptions(CheckOptions{})
+}
+
+// CheckWithOptions checks the tools from the configuration with options and
+// returns an error when any of them doesn't meet its requirements
+func CheckWithOptions(options CheckOptions) error {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get configuration: %w", err)
+	}
+
+	ui.PrintTitle("Checking Tools from Configuration")
+
+	failed := 0
+	for _, spec := range cfg.Tools {
+		tool := ResolveTool(spec)
+		if !tool.OnPlatform() || !tool.HasTag(options.Tags...) {
+			continue
+		}
+
+		check := CheckTool(tool)
+		if check.Failed() {
+			failed++
+		}
+		printCheck(check, options.Verbose)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d tools don't meet their requirements, run 'milo system install' to fix them", failed)
+	}
+
+	ui.PrintSuccess("All tools meet their requirements")
+	return nil
+}
+
+// printCheck prints the result of checking a tool
+func printCheck(check ToolCheck, verbose bool) {
+	tool := check.Tool
+	name := ui.FormatTextWithColor(tool.Name, &ui.StyleCommand, ui.ColorInfo)
+
+	var required string
+	switch {
+	case tool.Version != "":
+		required = fmt.Sprintf(" (pinned %s)", tool.Version)
+	case tool.MinVersion != "":
+		required = fmt.Sprintf(" (min %s)", tool.MinVersion)
+	}
+
+	message := fmt.Sprintf("%s: %s", name, check.Status)
+	if check.Version != "" {
+		message = fmt.Sprintf("%s: %s %s%s", name, check.Status, check.Version, required)
+	} else if required != "" {
+		message += required
+	}
+	if tool.Optional {
+		message += " (optional)"
+	}
+
+	switch {
+	case check.Failed():
+		ui.PrintError("%s", message)
+	case check.Status == CheckOK:
+		ui.PrintSuccess("%s", message)
+	default:
+		ui.PrintWarning("%s", message)
+	}
+
+	if verbose && check.Err != nil {
+		ui.PrintInfo("  %v", check.Err)
+	}
+}
@@ -1,13 +1,9 @@
 package system
 
 import (
-	"fmt"
-	"os/exec"
 	"runtime"
-	"strings"
 
-	"github.com/bayou-brogrammer/mygo/internal/logger"
-	"github.com/bayou-brogrammer/mygo/internal/shell"
+	"github.com/bayou-brogrammer/mygo/internal/platform"
 	"github.com/bayou-brogrammer/mygo/internal/ui"
 )
 
@@ -29,59 +25,27 @@ func InfoWithOptions(options InfoOptions) error {
 	ui.PrintTitle("System Information")
 
 	// Display OS information
-	osInfo := fmt.Sprintf("OS: %s (%s)", runtime.GOOS, runtime.GOARCH)
-	ui.PrintInfo(osInfo)
+	ui.PrintInfo("OS: %s (%s)", runtime.GOOS, runtime.GOARCH)
 
 	// Display Go version
-	goVersion := fmt.Sprintf("Go Version: %s", runtime.Version())
-	ui.PrintInfo(goVersion)
+	ui.PrintInfo("Go Version: %s", runtime.Version())
 
-	// Get package manager information
-	pkgManager, ok := packageManagers[runtime.GOOS]
-	if !ok {
-		errMsg := fmt.Sprintf("Unsupported platform: %s", runtime.GOOS)
-		logger.Error(errMsg)
-		ui.PrintError(errMsg)
-		return fmt.Errorf(errMsg)
+	// Display distribution information
+	if distro := platform.DetectDistro(); distro.PrettyName != "" {
+		ui.PrintInfo("Distribution: %s", distro.PrettyName)
 	}
 
-	// Check if package manager is installed
-	if !shell.CommandExists(pkgManager) {
-		errMsg := fmt.Sprintf("Package manager %s is not installed", pkgManager)
-		ui.PrintWarning(errMsg)
-	} else {
-		// Get package manager version
-		var version string
-		var err error
-
-		switch pkgManager {
-		case "brew":
-			cmd := exec.Command("brew", "--version")
-			output, err := cmd.Output()
-			if err == nil {
-				// Extract just the first line
-				lines := strings.Split(string(output), "\n")
-				if len(lines) > 0 {
-					version = lines[0]
-				}
-			}
-		case "apt":
-			cmd := exec.Command("apt", "--version")
-			output, err := cmd.Output()
-			if err == nil {
-				// Extract just the first line
-				lines := strings.Split(string(output), "\n")
-				if len(lines) > 0 {
-					version = lines[0]
-				}
-			}
-		}
+	// Display whether milo can install system packages
+	ui.PrintInfo("Privileges: %s", DetectPrivileges())
 
-		if err != nil {
-		} else if version != "" {
-			pkgInfo := fmt.Sprintf("Package Manager: %s", version)
-			ui.PrintInfo(pkgInfo)
-		}
+	// Get package manager information
+	pkgManager, err := DetectPackageManager()
+	if err != nil {
+		ui.PrintWarning("%v", err)
+	} else if version, err := pkgManager.Version(); err == nil {
+		ui.PrintInfo("Package Manager: %s (%s)", pkgManager.Name(), version)
+	} else {
+		ui.PrintInfo("Package Manager: %s", pkgManager.Name())
 	}
 
 	// Display installed tools if verbose
@@ -89,29 +53,20 @@ func InfoWithOptions(options InfoOptions) error {
 		ui.PrintSubtitle("Installed Tools")
 
 		// Common developer tools to check
-		tools := []string{
+		names := []string{
 			"git", "node", "npm", "python", "pip", "docker",
 			"kubectl", "terraform", "ansible", "make", "gcc",
 		}
 
-		for _, tool := range tools {
-			if shell.CommandExists(tool) {
-				// Try to get version
-				var version string
-				result, err := shell.Execute(tool, "--version")
-				if err == nil && result.Stdout != "" {
-					// Extract just the first line
-					lines := strings.Split(result.Stdout, "\n")
-					if len(lines) > 0 {
-						version = strings.TrimSpace(lines[0])
-					}
-				}
+		for _, name := range names {
+			tool := LookupTool(name)
+			if _, found := toolBinary(tool); found {
+				version, _ := ProbeVersion(tool)
 
 				if version != "" {
-					toolInfo := fmt.Sprintf("%s: %s", tool, version)
-					ui.PrintInfo(toolInfo)
+					ui.PrintInfo("%s: %s", tool.Name, version)
 				} else {
-					ui.PrintInfo("%s: installed (version unknown)", tool)
+					ui.PrintInfo("%s: installed (version unknown)", tool.Name)
 				}
 			}
 		}
@@ -2,7 +2,8 @@ package system
 
 import (
 	"fmt"
-	"runtime"
+	"strings"
+	"sync"
 
 	"github.com/bayou-brogrammer/mygo/internal/config"
 	"github.com/bayou-brogrammer/mygo/internal/logger"
@@ -10,12 +11,6 @@ import (
 	"github.com/bayou-brogrammer/mygo/internal/ui"
 )
 
-// Package managers by platform
-var packageManagers = map[string]string{
-	"darwin": "brew",
-	"linux":  "apt", // Default to apt, can be changed based on distro
-}
-
 // InstallOptions defines options for tool installation
 type InstallOptions struct {
 	// Force reinstallation even if the tool is already installed
@@ -26,6 +21,9 @@ type InstallOptions struct {
 
 	// Enable verbose output during installation
 	Verbose bool
+
+	// Only install configured tools with one of these tags, all when empty
+	Tags []string
 }
 
 // Install installs a specific tool or common development tools
@@ -36,129 +34,399 @@ func Install(tool string) error {
 	})
 }
 
+// maxParallelInstalls limits how many installers other than the package
+// manager run at once
+const maxParallelInstalls = 4
+
 // InstallWithOptions installs a specific tool or common development tools with options
 func InstallWithOptions(tool string, options InstallOptions) error {
 	// Get package manager for current platform
-	pkgManager, ok := packageManagers[runtime.GOOS]
-	if !ok {
-		logger.Error("Unsupported platform: %s - only darwin (macOS) and linux are supported", runtime.GOOS)
-		return fmt.Errorf("unsupported platform: %s - only darwin (macOS) and linux are supported", runtime.GOOS)
+	pkgManager, err := DetectPackageManager()
+	if err != nil {
+		logger.Error("%v", err)
+		return err
 	}
 
-	// Check if package manager is installed
-	if !shell.CommandExists(pkgManager) {
-		var errMsg error
-		switch pkgManager {
-		case "brew":
-			errMsg = fmt.Errorf("%s is not installed, please install Homebrew first: https://brew.sh", pkgManager)
-		case "apt":
-			errMsg = fmt.Errorf("%s is not installed, please install apt-get first", pkgManager)
-		default:
-			errMsg = fmt.Errorf("%s is not installed, please install it first", pkgManager)
-		}
-
-		return errMsg
+	// Get the configuration to access preferred tools
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get configuration: %w", err)
 	}
 
 	if tool != "" {
-		// Install specific tool
-		ui.PrintInfo("Installing tool: %s", tool)
-		InstallWithPackageManagers(tool, pkgManager, options)
-	} else {
-		// Get the configuration to access preferred tools
-		cfg, err := config.GetConfig()
-		if err != nil {
-			return fmt.Errorf("failed to get configuration: %w", err)
+		// Install specific tool, using its configured spec when there is one
+		spec, ok := cfg.FindTool(tool)
+		if !ok {
+			spec = config.ToolSpec{Name: tool}
 		}
 
-		// Run install over config tools
-		ui.PrintTitle("Installing Tools from Configuration")
+		ui.PrintInfo("Installing tool: %s", tool)
+		return InstallWithPackageManagers(spec, pkgManager, options)
+	}
 
-		for _, tool := range cfg.Tools {
-			err := InstallWithPackageManagers(tool, pkgManager, options)
-			if err != nil {
-				return err
-			}
+	// Run install over config tools
+	ui.PrintTitle("Installing Tools from Configuration")
+
+	var specs []config.ToolSpec
+	for _, spec := range cfg.Tools {
+		tool := ResolveTool(spec)
+		if tool.OnPlatform() && tool.HasTag(options.Tags...) {
+			specs = append(specs, tool)
 		}
+	}
 
-		ui.PrintSuccess("Finished installing all tools from configuration")
+	results := InstallTools(specs, pkgManager, options)
+	printSummary(results)
+
+	failed := 0
+	for _, result := range results {
+		if result.Failed() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d tools failed to install", failed, len(results))
 	}
 
+	ui.PrintSuccess("Finished installing all tools from configuration")
 	return nil
 }
 
-func InstallWithPackageManagers(tool string, pkgManager string, options InstallOptions) error {
+// InstallWithPackageManagers installs a tool with its install method, using
+// the given package manager for package installs, and checks that one of its
+// binaries ended up on PATH
+func InstallWithPackageManagers(spec config.ToolSpec, pkgManager PackageManager, options InstallOptions) error {
+	tool := ResolveTool(spec)
+
+	result, job := planInstall(tool, pkgManager, options)
+	if job != nil {
+		result = runJob(job, options)
+	}
+	return result.Err
+}
+
+// InstallTools installs tools and returns the outcome for each of them.
+// Package installs are batched into one package manager transaction, and
+// other installers run in parallel with it and each other.
+func InstallTools(specs []config.ToolSpec, pkgManager PackageManager, options InstallOptions) []InstallResult {
+	results := make([]InstallResult, len(specs))
+
+	var packages []int
+	jobs := make(map[int]*installJob)
+	for i, spec := range specs {
+		tool := ResolveTool(spec)
+
+		result, job := planInstall(tool, pkgManager, options)
+		if job == nil {
+			results[i] = result
+			continue
+		}
+		jobs[i] = job
+		if job.chosen.InstallMethod() == config.MethodPackage {
+			packages = append(packages, i)
+		}
+	}
+
+	// Each goroutine writes the results of its own tools only
+	var wg sync.WaitGroup
+	if len(packages) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			batch := make([]*installJob, len(packages))
+			for j, i := range packages {
+				batch[j] = jobs[i]
+			}
+			for j, result := range installBatch(batch, pkgManager, options) {
+				results[packages[j]] = result
+			}
+		}()
+	}
+
+	slots := make(chan struct{}, maxParallelInstalls)
+	for i, job := range jobs {
+		if job.chosen.InstallMethod() == config.MethodPackage {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			results[i] = runJob(job, options)
+		}()
+	}
+
+	wg.Wait()
+	return results
+}
+
+// installJob is a tool with the command chosen to install it
+type installJob struct {
+	tool config.ToolSpec
+
+	// Spec for the install method that was chosen
+	chosen config.ToolSpec
+
+	command toolCommand
+
+	// Path of the tool's binary before the install, empty when there was none
+	existing string
+}
+
+// planInstall decides what to do with a tool, returning either the result for
+// a tool that is skipped or can't be installed, or the job that installs it
+func planInstall(tool config.ToolSpec, pkgManager PackageManager, options InstallOptions) (InstallResult, *installJob) {
+	method := tool.InstallMethod()
+
 	// Format the tool name with accent color for better visibility
-	highlightedTool := ui.FormatTextWithColor(tool, &ui.StyleCommand, ui.ColorInfo)
+	highlightedTool := ui.FormatTextWithColor(tool.Name, &ui.StyleCommand, ui.ColorInfo)
 
-	// Check if tool is already installed and should be skipped
-	if shell.CommandExists(tool) && options.SkipExisting && !options.Force {
+	// Check if tool is already installed and should be skipped. Archives
+	// installed by milo at another version than the pinned one are upgraded.
+	existing, found := toolBinary(tool)
+	if found && (method == config.MethodSystem || options.SkipExisting && !options.Force && !outdatedArchive(tool)) {
 		ui.PrintInfo("%s is already installed, skipping", highlightedTool)
-		return nil
+		return InstallResult{Tool: tool, Outcome: OutcomeSkipped}, nil
 	}
 
 	ui.PrintCommand("Installing %s", highlightedTool)
 
+	command, chosen, err := chooseInstall(tool, pkgManager, options.Force)
+	if err != nil {
+		ui.PrintError("%v", err)
+		return InstallResult{Tool: tool, Outcome: OutcomeUnsupported, Err: err}, nil
+	}
+
+	return InstallResult{}, &installJob{tool: tool, chosen: chosen, command: command, existing: existing}
+}
+
+// installBatch installs package jobs in one package manager transaction.
+// When the transaction fails, the packages are installed one at a time so
+// only the ones at fault fail.
+func installBatch(jobs []*installJob, pkgManager PackageManager, options InstallOptions) []InstallResult {
+	results := make([]InstallResult, len(jobs))
+	if len(jobs) == 1 {
+		results[0] = runJob(jobs[0], options)
+		return results
+	}
+
+	pkgs := make([]string, len(jobs))
+	for i, job := range jobs {
+		pkgs[i], _ = job.chosen.Package(pkgManager.Name())
+	}
+
+	operation := "install"
+	if options.Force {
+		operation = "reinstall"
+	}
+
+	// Display the operation being executed with proper formatting
+	ui.PrintInfo("Running: %s %s %s",
+		ui.FormatCommand(pkgManager.Name()),
+		ui.FormatValue(operation),
+		ui.FormatValue(strings.Join(pkgs, " ")))
+
 	var result *shell.Result
 	var err error
+	if options.Force {
+		result, err = pkgManager.Reinstall(pkgs...)
+	} else {
+		result, err = pkgManager.Install(pkgs...)
+	}
 
-	// Display the command being executed with proper formatting
-	switch pkgManager {
-	case "brew":
-		if options.Force {
-			// Show the command with nice formatting
-			ui.PrintInfo("Running: %s %s %s",
-				ui.FormatCommand("brew"),
-				ui.FormatValue("reinstall"),
-				highlightedTool)
-			result, err = shell.Execute("brew", "reinstall", tool)
-		} else {
-			// Show the command with nice formatting
-			ui.PrintInfo("Running: %s %s %s",
-				ui.FormatCommand("brew"),
-				ui.FormatValue("install"),
-				highlightedTool)
-			result, err = shell.Execute("brew", "install", tool)
-		}
-	case "apt":
-		if options.Force {
-			// Show the command with nice formatting
-			ui.PrintInfo("Running: %s %s %s %s %s %s",
-				ui.FormatCommand("sudo"),
-				ui.FormatCommand("apt"),
-				ui.FormatValue("install"),
-				ui.FormatValue("--reinstall"),
-				ui.FormatValue("-y"),
-				highlightedTool)
-			result, err = shell.Execute("sudo", "apt", "install", "--reinstall", "-y", tool)
-		} else {
-			// Show the command with nice formatting
-			ui.PrintInfo("Running: %s %s %s %s %s",
-				ui.FormatCommand("sudo"),
-				ui.FormatCommand("apt"),
-				ui.FormatValue("install"),
-				ui.FormatValue("-y"),
-				highlightedTool)
-			result, err = shell.Execute("sudo", "apt", "install", "-y", tool)
+	if err != nil {
+		ui.PrintWarning("Installing %d packages together failed, installing them one at a time: %v", len(pkgs), withStderr(result, err))
+		for i, job := range jobs {
+			results[i] = runJob(job, options)
 		}
+		return results
+	}
+
+	printOutput(result, options.Verbose)
+	for i, job := range jobs {
+		results[i] = finishJob(job, result, nil)
+	}
+	return results
+}
+
+// runJob runs the command of a job
+func runJob(job *installJob, options InstallOptions) InstallResult {
+	// Display the operation being executed with proper formatting
+	ui.PrintInfo("Running: %s %s",
+		ui.FormatCommand(job.command.name),
+		ui.FormatValue(strings.Join(job.command.args, " ")))
+
+	result, err := job.command.run()
+	if err == nil {
+		printOutput(result, options.Verbose)
 	}
+	return finishJob(job, result, err)
+}
+
+// finishJob checks that a job installed its tool
+func finishJob(job *installJob, result *shell.Result, err error) InstallResult {
+	tool := job.tool
+	outcome := InstallResult{Tool: tool, Method: job.chosen.InstallMethod(), Output: result}
 
 	if err != nil {
-		return fmt.Errorf("failed to install %s: %v", tool, err)
+		outcome.Outcome = OutcomeFailed
+		outcome.Err = fmt.Errorf("failed to install %s: %w", tool.Name, withStderr(result, err))
+		ui.PrintError("%v", outcome.Err)
+		return outcome
+	}
+
+	// Make sure the install really provides the tool
+	if _, found := toolBinary(tool); !found && outcome.Method == config.MethodArchive {
+		binDir, _ := UserBinDir()
+		ui.PrintWarning("%s is installed in %s, which is not on PATH", tool.Name, binDir)
+	} else if !found {
+		outcome.Outcome = OutcomeFailed
+		outcome.Err = fmt.Errorf("installed %s with %s, but none of %s is on PATH", tool.Name, job.command.name, strings.Join(tool.BinaryNames(), ", "))
+		ui.PrintError("%v", outcome.Err)
+		return outcome
+	}
+
+	// Remember where the tool came from, so it can be listed and uninstalled
+	if err := recordInstall(job); err != nil {
+		ui.PrintWarning("Failed to record the install of %s: %v", tool.Name, err)
 	}
 
 	// Print success message
-	ui.PrintSuccess("Successfully installed %s", highlightedTool)
+	ui.PrintSuccess("Successfully installed %s", ui.FormatTextWithColor(tool.Name, &ui.StyleCommand, ui.ColorInfo))
+
+	outcome.Outcome = OutcomeInstalled
+	return outcome
+}
+
+// printOutput prints the output of an install command if verbose
+func printOutput(result *shell.Result, verbose bool) {
+	if !verbose || result == nil {
+		return
+	}
+	if result.Stdout != "" {
+		ui.PrintBox(fmt.Sprintf("Output:\n%s", result.Stdout))
+	}
+	if result.Stderr != "" {
+		ui.PrintErrorBox(fmt.Sprintf("Errors:\n%s", result.Stderr))
+	}
+}
+
+// outdatedArchive reports whether milo installed the tool from an archive of
+// another version than the one pinned now
+func outdatedArchive(tool config.ToolSpec) bool {
+	if tool.InstallMethod() != config.MethodArchive {
+		return false
+	}
+	records, err := ReadRecords()
+	if err != nil {
+		return false
+	}
+	record, ok := records[tool.Name]
+	return ok && record.Method == config.MethodArchive && record.Version != tool.Version
+}
+
+// toolCommand is the command that installs a tool
+type toolCommand struct {
+	// Name shown to the user, such as the package manager
+	name string
 
-	// Print detailed output if verbose
-	if options.Verbose {
-		if result.Stdout != "" {
-			ui.PrintBox(fmt.Sprintf("Output:\n%s", result.Stdout))
+	// Arguments shown to the user
+	args []string
+
+	run func() (*shell.Result, error)
+}
+
+// chooseInstall picks the first of the tool's install methods that works on
+// this machine and returns its command and the spec for that method. When
+// none works, the error explains why for each of them.
+func chooseInstall(tool config.ToolSpec, pkgManager PackageManager, force bool) (toolCommand, config.ToolSpec, error) {
+	candidates := tool.Candidates()
+
+	var reasons []string
+	for _, candidate := range candidates {
+		command, err := installCommand(candidate, pkgManager, force)
+		if err == nil {
+			if len(reasons) > 0 {
+				ui.PrintInfo("Installing %s with %s, because %s", tool.Name, candidate.InstallMethod(), strings.Join(reasons, "; "))
+			}
+			return command, candidate, nil
 		}
-		if result.Stderr != "" {
-			ui.PrintErrorBox(fmt.Sprintf("Errors:\n%s", result.Stderr))
+		if len(candidates) == 1 {
+			return toolCommand{}, tool, withHint(tool, err)
 		}
+		reasons = append(reasons, fmt.Sprintf("%s: %v", candidate.InstallMethod(), err))
 	}
 
-	return nil
+	return toolCommand{}, tool, withHint(tool, fmt.Errorf("can't install %s: %s", tool.Name, strings.Join(reasons, "; ")))
+}
+
+// installCommand builds the command that installs a tool with its method, or
+// explains why the method can't be used
+func installCommand(tool config.ToolSpec, pkgManager PackageManager, force bool) (toolCommand, error) {
+	if err := tool.Validate(); err != nil {
+		return toolCommand{}, err
+	}
+
+	switch method := tool.InstallMethod(); method {
+	case config.MethodPackage, config.MethodSystem:
+		pkg, ok := tool.Package(pkgManager.Name())
+		if !ok {
+			return toolCommand{}, unsupported(tool, pkgManager.Name())
+		}
+		if privileges := DetectPrivileges(); pkgManager.NeedsRoot() && !privileges.CanRunAsRoot() {
+			return toolCommand{}, privileges.rootError(fmt.Sprintf("installing %s with %s", pkg, pkgManager.Name()))
+		}
+		if force {
+			return toolCommand{pkgManager.Name(), []string{"reinstall", pkg}, func() (*shell.Result, error) {
+				return pkgManager.Reinstall(pkg)
+			}}, nil
+		}
+		return toolCommand{pkgManager.Name(), []string{"install", pkg}, func() (*shell.Result, error) {
+			return pkgManager.Install(pkg)
+		}}, nil
+
+	case config.MethodGo, config.MethodCargo, config.MethodPipx:
+		args := []string{"install", tool.Source}
+		if force && method != config.MethodGo {
+			args = append(args, "--force")
+		}
+		if !shell.CommandExists(method) {
+			return toolCommand{}, fmt.Errorf("%s needs %s to install, but it is not on PATH", tool.Name, method)
+		}
+		return toolCommand{method, args, func() (*shell.Result, error) {
+			return shell.Execute(method, args...)
+		}}, nil
+
+	case config.MethodArchive:
+		url, err := archiveURL(tool)
+		if err != nil {
+			return toolCommand{}, err
+		}
+		return toolCommand{"download", []string{url}, func() (*shell.Result, error) {
+			record, err := installArchive(tool)
+			if err != nil {
+				return nil, err
+			}
+			return &shell.Result{Stdout: fmt.Sprintf("Installed %s\n", strings.Join(record.Files, "\n"))}, nil
+		}}, nil
+
+	case config.MethodScript:
+		return toolCommand{"sh", []string{"-c", tool.Source}, func() (*shell.Result, error) {
+			return shell.Execute("sh", "-c", tool.Source)
+		}}, nil
+
+	default:
+		return toolCommand{}, fmt.Errorf("unsupported install method %s for %s", method, tool.Name)
+	}
+}
+
+// withStderr adds the stderr of a failed command to its error
+func withStderr(result *shell.Result, err error) error {
+	if result != nil {
+		if stderr := strings.TrimSpace(result.Stderr); stderr != "" {
+			return fmt.Errorf("%w: %s", err, stderr)
+		}
+	}
+	return err
 }
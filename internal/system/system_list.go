@@ -0,0 +1,146 @@
+package system
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/ui"
+)
+
+// ListOptions defines options for listing tools
+type ListOptions struct {
+	// Enable verbose output
+	Verbose bool
+}
+
+// ToolSource describes where an installed tool came from
+type ToolSource struct {
+	Tool string
+
+	// Install record, nil when milo didn't install the tool
+	Record *InstallRecord
+
+	// Path of the tool's binary, empty when missing
+	Path string
+
+	// Installed version, from the record or the tool itself
+	Version string
+}
+
+// String describes the source for the user
+func (s ToolSource) String() string {
+	switch {
+	case s.Record == nil && s.Path == "":
+		return "missing"
+	case s.Record == nil:
+		return "not installed by milo"
+	}
+
+	r := s.Record
+	var source string
+	switch r.Method {
+	case config.MethodPackage:
+		source = fmt.Sprintf("%s package %s", r.Manager, r.Package)
+	case config.MethodArchive, config.MethodScript:
+		source = fmt.Sprintf("%s %s", r.Method, r.Source)
+	default:
+		source = fmt.Sprintf("%s %s", r.Method, r.Package)
+	}
+	if s.Path == "" {
+		source += " (binary missing)"
+	}
+	return source
+}
+
+// Sources returns where each configured tool and each tool milo installed
+// came from, sorted by name
+func Sources() ([]ToolSource, error) {
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get configuration: %w", err)
+	}
+
+	records, err := ReadRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	tools := make(map[string]config.ToolSpec)
+	for _, spec := range cfg.Tools {
+		if tool := ResolveTool(spec); tool.OnPlatform() {
+			tools[tool.Name] = tool
+		}
+	}
+	for name := range records {
+		if _, ok := tools[name]; !ok {
+			tools[name] = LookupTool(name)
+		}
+	}
+
+	sources := make([]ToolSource, 0, len(tools))
+	for name, tool := range tools {
+		source := ToolSource{Tool: name}
+		if record, ok := records[name]; ok {
+			source.Record = &record
+			source.Version = record.Version
+		}
+		source.Path, _ = toolBinary(tool)
+		if source.Version == "" && source.Path != "" {
+			source.Version, _ = ProbeVersion(tool)
+		}
+		sources = append(sources, source)
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		return sources[i].Tool < sources[j].Tool
+	})
+	return sources, nil
+}
+
+// List prints where each tool came from
+func List() error {
+	return ListWithOptions(ListOptions{})
+}
+
+// ListWithOptions prints where each tool came from with options
+func ListWithOptions(options ListOptions) error {
+	sources, err := Sources()
+	if err != nil {
+		return err
+	}
+
+	ui.PrintTitle("Tools")
+
+	width := 0
+	for _, source := range sources {
+		width = max(width, len(source.Tool))
+	}
+
+	for _, source := range sources {
+		version := source.Version
+		if version == "" {
+			version = "-"
+		}
+
+		switch {
+		case source.Record != nil && source.Path != "":
+			ui.PrintSuccess("%-*s  %-10s  %s", width, source.Tool, version, source)
+		case source.Path != "":
+			ui.PrintInfo("%-*s  %-10s  %s", width, source.Tool, version, source)
+		default:
+			ui.PrintWarning("%-*s  %-10s  %s", width, source.Tool, version, source)
+		}
+
+		if options.Verbose && source.Record != nil {
+			ui.PrintInfo("  installed %s", source.Record.InstalledAt.Format("2006-01-02 15:04"))
+			for _, file := range source.Record.Files {
+				ui.PrintInfo("  %s", file)
+			}
+		} else if options.Verbose && source.Path != "" {
+			ui.PrintInfo("  %s", source.Path)
+		}
+	}
+
+	return nil
+}
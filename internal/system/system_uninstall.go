@@ -0,0 +1,107 @@
+package system
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/shell"
+	"github.com/bayou-brogrammer/mygo/internal/ui"
+)
+
+// UninstallOptions defines options for removing tools
+type UninstallOptions struct {
+	// Show what would be removed without removing anything
+	DryRun bool
+
+	// Enable verbose output
+	Verbose bool
+}
+
+// Uninstall removes a tool milo installed
+func Uninstall(tool string) error {
+	return UninstallWithOptions(tool, UninstallOptions{})
+}
+
+// UninstallWithOptions removes a tool milo installed, using its install record
+// to remove only what milo put there. Tools milo didn't install are left alone.
+func UninstallWithOptions(tool string, options UninstallOptions) error {
+	records, err := ReadRecords()
+	if err != nil {
+		return err
+	}
+
+	record, ok := records[tool]
+	if !ok {
+		if path, found := toolBinary(LookupTool(tool)); found {
+			return fmt.Errorf("%s at %s wasn't installed by milo, remove it the way it was installed", tool, path)
+		}
+		return fmt.Errorf("%s wasn't installed by milo", tool)
+	}
+
+	highlightedTool := ui.FormatTextWithColor(tool, &ui.StyleCommand, ui.ColorInfo)
+	ui.PrintCommand("Uninstalling %s", highlightedTool)
+
+	var result *shell.Result
+	switch record.Method {
+	case config.MethodPackage:
+		pkgManager, err := DetectPackageManager()
+		if err != nil {
+			return err
+		}
+		if pkgManager.Name() != record.Manager {
+			return fmt.Errorf("%s was installed with %s, but the package manager is now %s", tool, record.Manager, pkgManager.Name())
+		}
+
+		ui.PrintInfo("Running: %s %s %s",
+			ui.FormatCommand(pkgManager.Name()),
+			ui.FormatValue("remove"),
+			ui.FormatValue(record.Package))
+		if options.DryRun {
+			break
+		}
+		result, err = pkgManager.Remove(record.Package)
+		if err != nil {
+			return fmt.Errorf("failed to uninstall %s: %w", tool, withStderr(result, err))
+		}
+
+	case config.MethodCargo, config.MethodPipx:
+		ui.PrintInfo("Running: %s %s %s",
+			ui.FormatCommand(record.Method),
+			ui.FormatValue("uninstall"),
+			ui.FormatValue(record.Package))
+		if options.DryRun {
+			break
+		}
+		result, err = shell.Execute(record.Method, "uninstall", record.Package)
+		if err != nil {
+			return fmt.Errorf("failed to uninstall %s: %w", tool, withStderr(result, err))
+		}
+
+	default:
+		if len(record.Files) == 0 {
+			return fmt.Errorf("milo didn't record any files for %s, remove it by hand", tool)
+		}
+		for _, file := range record.Files {
+			ui.PrintInfo("Removing %s", file)
+			if options.DryRun {
+				continue
+			}
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove %s: %w", file, err)
+			}
+		}
+	}
+
+	if options.DryRun {
+		return nil
+	}
+
+	if err := deleteRecord(tool); err != nil {
+		return err
+	}
+
+	printOutput(result, options.Verbose)
+	ui.PrintSuccess("Successfully uninstalled %s", highlightedTool)
+	return nil
+}
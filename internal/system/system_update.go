@@ -2,10 +2,9 @@ package system
 
 import (
 	"fmt"
-	"runtime"
 
+	"github.com/bayou-brogrammer/mygo/internal/config"
 	"github.com/bayou-brogrammer/mygo/internal/logger"
-	"github.com/bayou-brogrammer/mygo/internal/shell"
 	"github.com/bayou-brogrammer/mygo/internal/ui"
 )
 
@@ -25,78 +24,37 @@ func Update() error {
 // UpdateWithOptions updates installed development tools with options
 func UpdateWithOptions(options UpdateOptions) error {
 	// Get package manager for current platform
-	pkgManager, ok := packageManagers[runtime.GOOS]
-	if !ok {
-		errMsg := fmt.Sprintf("Unsupported platform: %s - only darwin (macOS) and linux are supported", runtime.GOOS)
-		logger.Error(errMsg)
-		ui.PrintError(errMsg)
-		return fmt.Errorf(errMsg)
-	}
-
-	// Check if package manager is installed
-	if !shell.CommandExists(pkgManager) {
-		var errMsg string
-		switch pkgManager {
-		case "brew":
-			errMsg = fmt.Sprintf("%s is not installed, please install Homebrew first: https://brew.sh", pkgManager)
-		case "apt":
-			errMsg = fmt.Sprintf("%s is not installed, please install apt-get first", pkgManager)
-		default:
-			errMsg = fmt.Sprintf("%s is not installed, please install it first", pkgManager)
-		}
-		logger.Error(errMsg)
-		ui.PrintError(errMsg)
-		return fmt.Errorf(errMsg)
+	pkgManager, err := DetectPackageManager()
+	if err != nil {
+		logger.Error("%v", err)
+		ui.PrintError("%v", err)
+		return err
 	}
 
-	// Update package manager
-	var result *shell.Result
-	var err error
-
 	ui.PrintTitle("System Update")
 
-	switch pkgManager {
-	case "brew":
-		ui.PrintInfo("Updating Homebrew...")
-		result, err = shell.Execute("brew", "update")
-		if err != nil {
-			errMsg := fmt.Sprintf("Failed to update Homebrew: %v", err)
-			logger.Error(errMsg)
-			ui.PrintError(errMsg)
-			return fmt.Errorf("failed to update Homebrew: %w", err)
-		}
-		if options.Verbose {
-			if result.Stdout != "" {
-				ui.PrintBox(fmt.Sprintf("Output:\n%s", result.Stdout))
-			}
-		}
-
-		ui.PrintInfo("Upgrading Homebrew packages...")
-		result, err = shell.Execute("brew", "upgrade")
-	case "apt":
-		ui.PrintInfo("Updating apt repositories...")
-		result, err = shell.Execute("sudo", "apt", "update")
-		if err != nil {
-			errMsg := fmt.Sprintf("Failed to update apt repositories: %v", err)
-			logger.Error(errMsg)
-			ui.PrintError(errMsg)
-			return fmt.Errorf("failed to update apt repositories: %w", err)
-		}
-		if options.Verbose {
-			if result.Stdout != "" {
-				ui.PrintBox(fmt.Sprintf("Output:\n%s", result.Stdout))
-			}
+	// Update package index
+	ui.PrintInfo("Updating %s package index...", pkgManager.Name())
+	result, err := pkgManager.UpdateIndex()
+	if err != nil {
+		errMsg := fmt.Sprintf("Failed to update %s package index: %v", pkgManager.Name(), withStderr(result, err))
+		logger.Error("%s", errMsg)
+		ui.PrintError("%s", errMsg)
+		return fmt.Errorf("failed to update %s package index: %w", pkgManager.Name(), withStderr(result, err))
+	}
+	if options.Verbose {
+		if result.Stdout != "" {
+			ui.PrintBox(fmt.Sprintf("Output:\n%s", result.Stdout))
 		}
-
-		ui.PrintInfo("Upgrading apt packages...")
-		result, err = shell.Execute("sudo", "apt", "upgrade", "-y")
 	}
 
+	ui.PrintInfo("Upgrading %s packages...", pkgManager.Name())
+	result, err = pkgManager.Upgrade()
 	if err != nil {
-		errMsg := fmt.Sprintf("Failed to upgrade packages: %v", err)
-		logger.Error(errMsg)
-		ui.PrintError(errMsg)
-		return fmt.Errorf("failed to upgrade packages: %w", err)
+		errMsg := fmt.Sprintf("Failed to upgrade packages: %v", withStderr(result, err))
+		logger.Error("%s", errMsg)
+		ui.PrintError("%s", errMsg)
+		return fmt.Errorf("failed to upgrade packages: %w", withStderr(result, err))
 	}
 
 	if options.Verbose {
@@ -105,6 +63,22 @@ func UpdateWithOptions(options UpdateOptions) error {
 		}
 	}
 
+	// Upgrade archives whose pinned version changed since milo installed them
+	cfg, err := config.GetConfig()
+	if err != nil {
+		return fmt.Errorf("failed to get configuration: %w", err)
+	}
+	for _, spec := range cfg.Tools {
+		tool := ResolveTool(spec)
+		if !tool.OnPlatform() || !outdatedArchive(tool) {
+			continue
+		}
+		ui.PrintInfo("Upgrading %s to %s...", tool.Name, tool.Version)
+		if err := InstallWithPackageManagers(tool, pkgManager, InstallOptions{SkipExisting: true, Verbose: options.Verbose}); err != nil {
+			return err
+		}
+	}
+
 	ui.PrintSuccess("System update completed successfully")
 	return nil
 }
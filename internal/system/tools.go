@@ -0,0 +1,193 @@
+package system
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+)
+
+// tools are the tools milo knows how to install, by name
+var tools = map[string]config.ToolSpec{
+	"bash": {Name: "bash", Description: "GNU Bourne-Again shell", Tags: []string{"shell"}},
+	"bat": {
+		Name:        "bat",
+		Description: "cat with syntax highlighting",
+		Binaries:    []string{"bat", "batcat"},
+		Tags:        []string{"cli"},
+	},
+	"brew": {
+		Name:        "brew",
+		Description: "Homebrew package manager",
+		Method:      config.MethodScript,
+		Source:      `NONINTERACTIVE=1 /bin/bash -c "$(curl -fsSL https://raw.githubusercontent.com/Homebrew/install/HEAD/install.sh)"`,
+	},
+	"cat": {Name: "cat", Method: config.MethodSystem},
+	"chezmoi": {
+		Name:        "chezmoi",
+		Description: "Dotfiles manager",
+		Packages: map[string]string{
+			"apk": "chezmoi", "brew": "chezmoi", "pacman": "chezmoi", "zypper": "chezmoi",
+		},
+		Tags: []string{"dotfiles"},
+		Alternatives: []config.InstallOption{{
+			Method: config.MethodScript,
+			Source: `sh -c "$(curl -fsLS get.chezmoi.io)" -- -b "$HOME/.local/bin"`,
+		}},
+	},
+	"cp":   {Name: "cp", Method: config.MethodSystem},
+	"curl": {Name: "curl", Description: "URL transfer tool", Tags: []string{"net"}},
+	"diff": {
+		Name: "diff",
+		Packages: map[string]string{
+			"apt": "diffutils", "dnf": "diffutils", "pacman": "diffutils",
+			"zypper": "diffutils", "apk": "diffutils", "brew": "diffutils",
+		},
+	},
+	"du": {Name: "du", Method: config.MethodSystem},
+	"fd": {
+		Name:        "fd",
+		Description: "Fast alternative to find",
+		Packages: map[string]string{
+			"apt": "fd-find", "dnf": "fd-find", "pacman": "fd",
+			"zypper": "fd", "apk": "fd", "brew": "fd",
+		},
+		Binaries: []string{"fd", "fdfind"},
+		Tags:     []string{"cli"},
+	},
+	"gh": {
+		Name:        "gh",
+		Description: "GitHub CLI",
+		Packages: map[string]string{
+			"apt": "gh", "dnf": "gh", "pacman": "github-cli",
+			"zypper": "gh", "apk": "github-cli", "brew": "gh",
+		},
+		Tags: []string{"dev"},
+	},
+	"git": {Name: "git", Description: "Version control", Tags: []string{"dev"}},
+	"go": {
+		Name:        "go",
+		Description: "Go toolchain",
+		Packages: map[string]string{
+			"apt": "golang-go", "dnf": "golang", "pacman": "go",
+			"zypper": "go", "apk": "go", "brew": "go",
+		},
+		VersionCommand: "go version",
+		VersionRegex:   `go(\d+(?:\.\d+)+)`,
+		Tags:           []string{"dev"},
+	},
+	"jq": {Name: "jq", Description: "JSON processor", Tags: []string{"cli"}},
+	"python": {
+		Name:        "python",
+		Description: "Python interpreter",
+		Packages: map[string]string{
+			"apt": "python3", "dnf": "python3", "pacman": "python",
+			"zypper": "python3", "apk": "python3", "brew": "python",
+		},
+		Binaries: []string{"python3", "python"},
+		Tags:     []string{"dev"},
+	},
+	"rg": {
+		Name:        "rg",
+		Description: "Fast recursive grep",
+		Packages: map[string]string{
+			"apt": "ripgrep", "dnf": "ripgrep", "pacman": "ripgrep",
+			"zypper": "ripgrep", "apk": "ripgrep", "brew": "ripgrep",
+		},
+		Tags: []string{"cli"},
+	},
+	"tmux": {Name: "tmux", Description: "Terminal multiplexer", Tags: []string{"shell"}},
+	"vim":  {Name: "vim", Description: "Text editor", Tags: []string{"editor"}},
+	"wget": {Name: "wget", Description: "Network downloader", Tags: []string{"net"}},
+	"zsh":  {Name: "zsh", Description: "Z shell", Tags: []string{"shell"}},
+}
+
+// toolHints explain how to install tools when none of their install methods can
+var toolHints = map[string]string{
+	"chezmoi": "set chezmoi_binary and run 'milo chezmoi bootstrap'",
+}
+
+// LookupTool returns the built-in spec of a tool. Unknown tools are installed
+// from a package with their own name and checked by a binary of that name.
+func LookupTool(name string) config.ToolSpec {
+	if tool, ok := tools[name]; ok {
+		return tool
+	}
+	return config.ToolSpec{Name: name}
+}
+
+// ResolveTool fills in the fields a configured spec leaves empty from the
+// built-in spec of the same name
+func ResolveTool(spec config.ToolSpec) config.ToolSpec {
+	tool := LookupTool(spec.Name)
+
+	if spec.Description != "" {
+		tool.Description = spec.Description
+	}
+	if spec.Packages != nil {
+		tool.Packages = spec.Packages
+	}
+	if len(spec.Binaries) > 0 {
+		tool.Binaries = spec.Binaries
+	}
+	if spec.Version != "" {
+		tool.Version = spec.Version
+	}
+	if spec.MinVersion != "" {
+		tool.MinVersion = spec.MinVersion
+	}
+	if spec.VersionCommand != "" {
+		tool.VersionCommand = spec.VersionCommand
+	}
+	if spec.VersionRegex != "" {
+		tool.VersionRegex = spec.VersionRegex
+	}
+	if len(spec.Tags) > 0 {
+		tool.Tags = spec.Tags
+	}
+	if len(spec.Platforms) > 0 {
+		tool.Platforms = spec.Platforms
+	}
+	if spec.Optional {
+		tool.Optional = true
+	}
+	if spec.Method != "" {
+		tool.Method = spec.Method
+		tool.Source = spec.Source
+		tool.Checksums = spec.Checksums
+		tool.SkipChecksum = spec.SkipChecksum
+	}
+	if spec.Alternatives != nil {
+		tool.Alternatives = spec.Alternatives
+	}
+
+	return tool
+}
+
+// toolBinary returns the path of the first of the tool's binaries found on PATH
+func toolBinary(tool config.ToolSpec) (string, bool) {
+	for _, name := range tool.BinaryNames() {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
+
+// unsupported explains why the tool can't be installed with a package manager
+func unsupported(tool config.ToolSpec, manager string) error {
+	if tool.InstallMethod() == config.MethodSystem {
+		return fmt.Errorf("%s is part of the base system and not installed by milo, but none of %s is on PATH", tool.Name, strings.Join(tool.BinaryNames(), ", "))
+	}
+
+	return fmt.Errorf("no %s package provides %s", manager, tool.Name)
+}
+
+// withHint adds how to install a tool by hand to an error, when milo knows
+func withHint(tool config.ToolSpec, err error) error {
+	if hint, ok := toolHints[tool.Name]; ok {
+		return fmt.Errorf("%w, %s", err, hint)
+	}
+	return err
+}
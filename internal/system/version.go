@@ -0,0 +1,93 @@
+package system
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bayou-brogrammer/mygo/internal/config"
+	"github.com/bayou-brogrammer/mygo/internal/shell"
+)
+
+// defaultVersionRegex matches the first dotted version number in the output
+const defaultVersionRegex = `(\d+(?:\.\d+)+)`
+
+// ProbeVersion runs the tool's version command and extracts its version
+func ProbeVersion(tool config.ToolSpec) (string, error) {
+	command := strings.Fields(tool.VersionCommand)
+	if len(command) == 0 {
+		path, found := toolBinary(tool)
+		if !found {
+			return "", fmt.Errorf("%s is not installed", tool.Name)
+		}
+		command = []string{path, "--version"}
+	}
+
+	pattern := tool.VersionRegex
+	if pattern == "" {
+		pattern = defaultVersionRegex
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", fmt.Errorf("invalid version regex for %s: %w", tool.Name, err)
+	}
+
+	result, err := shell.Execute(command[0], command[1:]...)
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s version: %w", tool.Name, withStderr(result, err))
+	}
+
+	// Some tools print their version to stderr
+	match := re.FindStringSubmatch(result.Stdout + "\n" + result.Stderr)
+	if match == nil {
+		return "", fmt.Errorf("no version found in the output of %s", strings.Join(command, " "))
+	}
+	if len(match) > 1 && match[1] != "" {
+		return strings.TrimPrefix(match[1], "v"), nil
+	}
+	return strings.TrimPrefix(match[0], "v"), nil
+}
+
+// CompareVersions compares two dotted versions such as "1.22.3" and "v1.22",
+// returning -1, 0 or 1. Missing components count as zero and anything after
+// the numeric part of a component, such as "-rc1", is ignored.
+func CompareVersions(a, b string) int {
+	as := versionParts(a)
+	bs := versionParts(b)
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionParts splits a version into its numeric components
+func versionParts(version string) []int {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+
+	var parts []int
+	for _, field := range strings.Split(version, ".") {
+		end := 0
+		for end < len(field) && field[end] >= '0' && field[end] <= '9' {
+			end++
+		}
+		n, _ := strconv.Atoi(field[:end])
+		parts = append(parts, n)
+		if end < len(field) {
+			break
+		}
+	}
+	return parts
+}
@@ -2,6 +2,7 @@ package ui
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/bayou-brogrammer/mygo/internal/logger"
 	"github.com/charmbracelet/lipgloss"
@@ -54,6 +55,24 @@ func PrintCommand(cmd string, args ...interface{}) {
 	fmt.Println(StyleCommand.Render(message))
 }
 
+// PrintDiff prints a unified diff with added and removed lines highlighted
+func PrintDiff(patch string) {
+	for _, line := range strings.Split(strings.TrimRight(patch, "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"), strings.HasPrefix(line, "diff "):
+			fmt.Println(StyleTextMuted.Render(line))
+		case strings.HasPrefix(line, "+"):
+			fmt.Println(StyleSuccess.Render(line))
+		case strings.HasPrefix(line, "-"):
+			fmt.Println(StyleError.Render(line))
+		case strings.HasPrefix(line, "@@"):
+			fmt.Println(StyleInfo.Render(line))
+		default:
+			fmt.Println(StyleTextDim.Render(line))
+		}
+	}
+}
+
 // PrintList prints a list of items
 func PrintList(items []string, selected int) {
 	for i, item := range items {
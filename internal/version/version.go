@@ -0,0 +1,5 @@
+package version
+
+// Version is the milo release, set at build time with
+// -ldflags "-X github.com/bayou-brogrammer/mygo/internal/version.Version=..."
+var Version = "0.1.0"